@@ -5,20 +5,159 @@ import (
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"log"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
+	Server            ServerConfig
+	Database          DatabaseConfig
+	JWT               JWTConfig
+	Mail              MailConfig
+	Password          PasswordConfig
+	EmailVerification EmailVerificationConfig
+	MFA               MFAConfig
+	WebAuthn          WebAuthnConfig
+	Lockout           LockoutConfig
+	RateLimit         RateLimitConfig
+	Audit             AuditConfig
+	OAuth             OAuthConfig
 }
 
 type ServerConfig struct {
 	Port    string
 	GinMode string
+	// FrontendURL is the base of the links sent by email
+	FrontendURL string
+	// TrustedProxies may set X-Forwarded-For, the client IP of rate limits and lockouts
+	TrustedProxies []string
+}
+
+type MailConfig struct {
+	Driver       string // smtp, log or file
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	DropDir      string // Directory used by the file driver
+}
+
+// Algorithms used to hash new passwords
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+type PasswordConfig struct {
+	ResetExpiration time.Duration
+	// HashAlgorithm hashes new passwords, hashes of the other algorithm or with
+	// other parameters are upgraded on the next login
+	HashAlgorithm     string
+	BcryptCost        int
+	Argon2Memory      uint32 // KiB
+	Argon2Time        uint32 // Iterations
+	Argon2Parallelism uint8
+	// Pepper is a server-side secret mixed into every hash, it is not stored in the database
+	Pepper string
+
+	MinLength           int
+	MaxLength           int
+	MinCharacterClasses int // Of lowercase, uppercase, digits and symbols
+	MinStrength         int // Strength score from 0 to 4
+	// DisallowPersonalInfo refuses passwords containing the name or email address
+	DisallowPersonalInfo bool
+	// BreachCorpusDir holds the Have I Been Pwned range files, empty skips the check
+	BreachCorpusDir string
+	// BreachThreshold is the number of breaches from which a password is refused
+	BreachThreshold int
+}
+
+// Policies for users who did not verify their email address yet
+const (
+	// EmailVerificationBlock refuses to log them in
+	EmailVerificationBlock = "block"
+	// EmailVerificationRestrict issues access tokens that carry no role and
+	// are refused by RequireRole and RequirePermission
+	EmailVerificationRestrict = "restrict"
+)
+
+type EmailVerificationConfig struct {
+	Policy     string
+	Expiration time.Duration
+}
+
+type MFAConfig struct {
+	// Issuer is the account name shown by authenticator apps
+	Issuer              string
+	ChallengeExpiration time.Duration
+}
+
+type WebAuthnConfig struct {
+	RPID          string // Domain the passkeys are bound to, without scheme and port
+	RPDisplayName string
+	RPOrigins     []string // Origins allowed to run the ceremonies
+	Timeout       time.Duration
+}
+
+// Stores of the failed login counters
+const (
+	LoginAttemptStorePostgres = "postgres"
+	LoginAttemptStoreMemory   = "memory"
+)
+
+type LockoutConfig struct {
+	Store              string
+	MaxAccountFailures int // Failures within FailureWindow that lock an account
+	MaxIPFailures      int // Failures within FailureWindow that lock a client IP
+	FailureWindow      time.Duration
+	// Duration is the first lockout, every consecutive one doubles up to MaxDuration
+	Duration    time.Duration
+	MaxDuration time.Duration
+	// ResetAfter forgets the previous lockouts after that long without failures
+	ResetAfter time.Duration
+}
+
+// Stores of the rate limit counters
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// Rate allows Requests per Window, a rate without requests is not limited
+type Rate struct {
+	Requests int
+	Window   time.Duration
+}
+
+type RateLimitConfig struct {
+	Store         string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	Login         Rate // Per client IP and per email address
+	Register      Rate // Per client IP
+	Refresh       Rate // Per client IP
+	Email         Rate // Emails sent to an address by the forgot password and resend verification routes
+	MFA           Rate // Per client IP for the challenge, per user for the TOTP routes
+}
+
+type AuditConfig struct {
+	// HashKey turns the hashes chaining the audit events into HMACs, so the
+	// chain cannot be recomputed by someone who can only write to the database
+	HashKey string
+}
+
+type OAuthConfig struct {
+	// ConsentURL is the frontend page /oauth/authorize sends the user to, with
+	// the parameters of the authorization request
+	ConsentURL     string
+	CodeExpiration time.Duration
 }
 
 type DatabaseConfig struct {
@@ -34,9 +173,12 @@ type DatabaseConfig struct {
 }
 
 type TokenConfig struct {
-	PrivateKeyPath string
-	PublicKeyPath  string
-	ExpirationTime time.Duration
+	KeyID           string // kid of the signing key, defaults to its RFC 7638 thumbprint
+	PrivateKeyPath  string
+	PublicKeyPath   string
+	SecretPath      string   // Shared secret file, only used by the HS* algorithms
+	RetiredKeyPaths []string // Public keys (or secrets) still accepted for verification, as "path" or "kid=path"
+	ExpirationTime  time.Duration
 }
 
 type JWTConfig struct {
@@ -57,10 +199,14 @@ func LoadConfig() {
 		panic("Error loading .env file")
 	}
 
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+
 	AppConfig = Config{
 		Server: ServerConfig{
-			Port:    getEnv("SERVER_PORT", "8080"),
-			GinMode: getEnv("GIN_MODE", "debug"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			GinMode:        getEnv("GIN_MODE", "debug"),
+			FrontendURL:    frontendURL,
+			TrustedProxies: getEnvAsSlice("TRUSTED_PROXIES", nil),
 		},
 		Database: DatabaseConfig{
 			Host:         getEnv("DB_HOST", "localhost"),
@@ -73,25 +219,163 @@ func LoadConfig() {
 			MaxOpenConns: getEnvAsInt("DB_MAX_OPEN_CONNS", 100),
 			MaxLifetime:  time.Duration(getEnvAsInt("DB_CONN_MAX_LIFETIME", 60)) * time.Minute,
 		},
-		JWT: JWTConfig{
-			Algorithm: getEnv("JWT_ALGORITHM", "RS256"),
-			Issuer:    getEnv("JWT_ISSUER", "golang"),
-			AccessToken: TokenConfig{
-				PrivateKeyPath: getEnv("JWT_ACCESS_PRIVATE_KEY_PATH", "keys/access_private.pem"),
-				PublicKeyPath:  getEnv("JWT_ACCESS_PUBLIC_KEY_PATH", "keys/access_public.pem"),
-				ExpirationTime: time.Duration(getEnvAsInt("JWT_ACCESS_EXPIRATION_TIME", 15)) * time.Minute,
-			},
-			RefreshToken: TokenConfig{
-				PrivateKeyPath: getEnv("JWT_REFRESH_PRIVATE_KEY_PATH", "keys/refresh_private.pem"),
-				PublicKeyPath:  getEnv("JWT_REFRESH_PUBLIC_KEY_PATH", "keys/refresh_public.pem"),
-				ExpirationTime: time.Duration(getEnvAsInt("JWT_REFRESH_EXPIRATION_TIME", 30)) * 24 * time.Hour, // 30 days
-			},
+		JWT: loadJWTConfig(),
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "no-reply@localhost"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			DropDir:      getEnv("MAIL_DROP_DIR", "tmp/mail"),
+		},
+		Password: PasswordConfig{
+			ResetExpiration:   time.Duration(getEnvAsInt("PASSWORD_RESET_EXPIRATION_TIME", 60)) * time.Minute,
+			HashAlgorithm:     getEnv("PASSWORD_HASH_ALGORITHM", PasswordHashArgon2id),
+			BcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 12),
+			Argon2Memory:      uint32(getEnvAsInt("PASSWORD_ARGON2_MEMORY", 64*1024)),
+			Argon2Time:        uint32(getEnvAsInt("PASSWORD_ARGON2_TIME", 3)),
+			Argon2Parallelism: uint8(getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 4)),
+			Pepper:            getEnv("PASSWORD_PEPPER", ""),
+
+			MinLength:            getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+			MaxLength:            getEnvAsInt("PASSWORD_MAX_LENGTH", 128),
+			MinCharacterClasses:  getEnvAsInt("PASSWORD_MIN_CHARACTER_CLASSES", 1),
+			MinStrength:          getEnvAsInt("PASSWORD_MIN_STRENGTH", 2),
+			DisallowPersonalInfo: getEnvAsBool("PASSWORD_DISALLOW_PERSONAL_INFO", true),
+			BreachCorpusDir:      getEnv("PASSWORD_BREACH_CORPUS_DIR", ""),
+			BreachThreshold:      getEnvAsInt("PASSWORD_BREACH_THRESHOLD", 1),
+		},
+		EmailVerification: EmailVerificationConfig{
+			Policy:     getEnv("EMAIL_VERIFICATION_POLICY", EmailVerificationRestrict),
+			Expiration: time.Duration(getEnvAsInt("EMAIL_VERIFICATION_EXPIRATION_TIME", 24)) * time.Hour,
+		},
+		MFA: MFAConfig{
+			Issuer:              getEnv("MFA_TOTP_ISSUER", "JWT Auth"),
+			ChallengeExpiration: time.Duration(getEnvAsInt("MFA_CHALLENGE_EXPIRATION_TIME", 5)) * time.Minute,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:          getEnv("WEBAUTHN_RP_ID", "localhost"),
+			RPDisplayName: getEnv("WEBAUTHN_RP_DISPLAY_NAME", "JWT Auth"),
+			RPOrigins:     getEnvAsSlice("WEBAUTHN_RP_ORIGINS", []string{frontendURL}),
+			Timeout:       time.Duration(getEnvAsInt("WEBAUTHN_TIMEOUT", 5)) * time.Minute,
 		},
+		Lockout: LockoutConfig{
+			Store:              getEnv("LOGIN_ATTEMPT_STORE", LoginAttemptStorePostgres),
+			MaxAccountFailures: getEnvAsInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+			MaxIPFailures:      getEnvAsInt("LOGIN_MAX_IP_FAILURES", 20),
+			FailureWindow:      time.Duration(getEnvAsInt("LOGIN_FAILURE_WINDOW", 15)) * time.Minute,
+			Duration:           time.Duration(getEnvAsInt("LOGIN_LOCKOUT_DURATION", 1)) * time.Minute,
+			MaxDuration:        time.Duration(getEnvAsInt("LOGIN_MAX_LOCKOUT_DURATION", 60)) * time.Minute,
+			ResetAfter:         time.Duration(getEnvAsInt("LOGIN_LOCKOUT_RESET_TIME", 24)) * time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Store:         getEnv("RATE_LIMIT_STORE", RateLimitStoreMemory),
+			RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+			RedisPassword: getEnv("REDIS_PASSWORD", ""),
+			RedisDB:       getEnvAsInt("REDIS_DB", 0),
+			Login:         getEnvAsRate("RATE_LIMIT_LOGIN", "10/1m"),
+			Register:      getEnvAsRate("RATE_LIMIT_REGISTER", "5/1h"),
+			Refresh:       getEnvAsRate("RATE_LIMIT_REFRESH", "30/1m"),
+			Email:         getEnvAsRate("RATE_LIMIT_EMAIL", "3/15m"),
+			MFA:           getEnvAsRate("RATE_LIMIT_MFA", "10/1m"),
+		},
+		Audit: AuditConfig{
+			HashKey: getEnv("AUDIT_HASH_KEY", ""),
+		},
+		OAuth: OAuthConfig{
+			ConsentURL:     getEnv("OAUTH_CONSENT_URL", frontendURL+"/oauth/consent"),
+			CodeExpiration: time.Duration(getEnvAsInt("OAUTH_CODE_EXPIRATION_TIME", 60)) * time.Second,
+		},
+	}
+
+	if err := validateIssuer(AppConfig.JWT.Issuer); err != nil {
+		panic(err.Error())
+	}
+	if insecureIssuer(AppConfig.JWT.Issuer) {
+		log.Printf("Warning: JWT_ISSUER %s is not an https URL, OpenID Connect clients will refuse it", AppConfig.JWT.Issuer)
+	}
+
+	switch AppConfig.EmailVerification.Policy {
+	case EmailVerificationBlock, EmailVerificationRestrict:
+	default:
+		panic("EMAIL_VERIFICATION_POLICY must be block or restrict")
+	}
+
+	switch AppConfig.Lockout.Store {
+	case LoginAttemptStorePostgres, LoginAttemptStoreMemory:
+	default:
+		panic("LOGIN_ATTEMPT_STORE must be postgres or memory")
+	}
+
+	switch AppConfig.RateLimit.Store {
+	case RateLimitStoreMemory, RateLimitStoreRedis:
+	default:
+		panic("RATE_LIMIT_STORE must be memory or redis")
 	}
 
 	initDB()
 }
 
+// loadJWTConfig reads the JWT settings from the environment
+func loadJWTConfig() JWTConfig {
+	return JWTConfig{
+		Algorithm: getEnv("JWT_ALGORITHM", "RS256"),
+		Issuer:    getEnv("JWT_ISSUER", "http://localhost:"+getEnv("SERVER_PORT", "8080")),
+		AccessToken: TokenConfig{
+			KeyID:           getEnv("JWT_ACCESS_KEY_ID", ""),
+			PrivateKeyPath:  getEnv("JWT_ACCESS_PRIVATE_KEY_PATH", "keys/access_private.pem"),
+			PublicKeyPath:   getEnv("JWT_ACCESS_PUBLIC_KEY_PATH", "keys/access_public.pem"),
+			SecretPath:      getEnv("JWT_ACCESS_SECRET_PATH", "keys/access_secret"),
+			RetiredKeyPaths: getEnvAsSlice("JWT_ACCESS_RETIRED_KEY_PATHS", nil),
+			ExpirationTime:  time.Duration(getEnvAsInt("JWT_ACCESS_EXPIRATION_TIME", 15)) * time.Minute,
+		},
+		RefreshToken: TokenConfig{
+			KeyID:           getEnv("JWT_REFRESH_KEY_ID", ""),
+			PrivateKeyPath:  getEnv("JWT_REFRESH_PRIVATE_KEY_PATH", "keys/refresh_private.pem"),
+			PublicKeyPath:   getEnv("JWT_REFRESH_PUBLIC_KEY_PATH", "keys/refresh_public.pem"),
+			SecretPath:      getEnv("JWT_REFRESH_SECRET_PATH", "keys/refresh_secret"),
+			RetiredKeyPaths: getEnvAsSlice("JWT_REFRESH_RETIRED_KEY_PATHS", nil),
+			ExpirationTime:  time.Duration(getEnvAsInt("JWT_REFRESH_EXPIRATION_TIME", 30)) * 24 * time.Hour, // 30 days
+		},
+	}
+}
+
+// ReloadJWTConfig re-reads the .env file and returns the JWT settings it describes
+func ReloadJWTConfig() (JWTConfig, error) {
+	if err := godotenv.Overload(".env"); err != nil {
+		return JWTConfig{}, fmt.Errorf("error reloading .env file: %v", err)
+	}
+
+	jwtConfig := loadJWTConfig()
+	if err := validateIssuer(jwtConfig.Issuer); err != nil {
+		return JWTConfig{}, err
+	}
+	return jwtConfig, nil
+}
+
+// validateIssuer checks that the issuer is the absolute URL of the server, the
+// discovery document builds the URLs of the endpoints from it
+func validateIssuer(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("JWT_ISSUER must be the http(s) URL of the server without query or fragment, e.g. https://auth.example.com, got %q", issuer)
+	}
+	return nil
+}
+
+// insecureIssuer reports whether OpenID Connect clients refuse the issuer.
+// They require https, plain http is only fine on loopback addresses.
+func insecureIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme == "https" {
+		return false
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	return host != "localhost" && (ip == nil || !ip.IsLoopback())
+}
+
 func initDB() {
 	var err error
 	dsn := GetDSN(&AppConfig.Database)
@@ -134,6 +418,19 @@ func getEnv(key string, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		var values []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		return values
+	}
+	return defaultValue
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -142,3 +439,47 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsRate reads a rate written as requests/window, e.g. 10/1m. A rate of
+// 0 requests disables the limit.
+func getEnvAsRate(key string, defaultValue string) Rate {
+	if value, exists := os.LookupEnv(key); exists {
+		if rate, err := parseRate(value); err == nil {
+			return rate
+		}
+	}
+
+	rate, err := parseRate(defaultValue)
+	if err != nil {
+		panic(err)
+	}
+	return rate
+}
+
+func parseRate(value string) (Rate, error) {
+	requests, window, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected requests/window", value)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("invalid number of requests in rate %q", value)
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid window in rate %q", value)
+	}
+
+	return Rate{Requests: n, Window: d}, nil
+}
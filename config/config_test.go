@@ -0,0 +1,51 @@
+package config
+
+import "testing"
+
+func TestValidateIssuer(t *testing.T) {
+	tests := []struct {
+		issuer string
+		valid  bool
+	}{
+		{"https://auth.example.com", true},
+		{"https://auth.example.com/tenant", true},
+		{"http://localhost:8080", true},
+		{"http://auth.example.com", true},
+		{"golang", false},
+		{"auth.example.com", false},
+		{"ftp://auth.example.com", false},
+		{"https://auth.example.com?tenant=1", false},
+		{"https://auth.example.com#top", false},
+		{"https://", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.issuer, func(t *testing.T) {
+			if err := validateIssuer(tt.issuer); (err == nil) != tt.valid {
+				t.Errorf("validateIssuer(%q) = %v, want valid %v", tt.issuer, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestInsecureIssuer(t *testing.T) {
+	tests := []struct {
+		issuer   string
+		insecure bool
+	}{
+		{"https://auth.example.com", false},
+		{"http://localhost:8080", false},
+		{"http://127.0.0.1:8080", false},
+		{"http://[::1]:8080", false},
+		{"http://auth.example.com", true},
+		{"http://192.0.2.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.issuer, func(t *testing.T) {
+			if got := insecureIssuer(tt.issuer); got != tt.insecure {
+				t.Errorf("insecureIssuer(%q) = %v, want %v", tt.issuer, got, tt.insecure)
+			}
+		})
+	}
+}
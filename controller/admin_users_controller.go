@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/model"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+)
+
+type AdminUsersController struct {
+	usersService *services.UsersService
+}
+
+func NewAdminUsersController() *AdminUsersController {
+	return &AdminUsersController{
+		usersService: services.NewUsersService(),
+	}
+}
+
+func (ac *AdminUsersController) ListUsers(c *gin.Context) {
+	var query types.ListUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	users, err := ac.usersService.ListUsers(&query)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (ac *AdminUsersController) GetUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := ac.usersService.GetUserForAdmin(userID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": services.ToUserResponse(user),
+	})
+}
+
+func (ac *AdminUsersController) ChangeRole(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req types.ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	user, err := ac.usersService.ChangeRole(actor, userID, model.UserRole(req.Role))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+func (ac *AdminUsersController) ChangeStatus(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req types.ChangeStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	user, err := ac.usersService.SetActive(actor, userID, *req.IsActive)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+func (ac *AdminUsersController) ForcePasswordReset(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	user, err := ac.usersService.ForcePasswordReset(actor, userID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+func (ac *AdminUsersController) UnlockUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	user, err := ac.usersService.UnlockUser(actor, userID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// DeleteUser soft-deletes the user, ?hard=true removes it permanently
+func (ac *AdminUsersController) DeleteUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := ac.usersService.DeleteUser(actor, userID, c.Query("hard") == "true"); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
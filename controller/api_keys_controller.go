@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+)
+
+type APIKeyController struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyController() *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: services.NewAPIKeyService(),
+	}
+}
+
+// ListAPIKeys lists the API keys of the current user
+func (kc *APIKeyController) ListAPIKeys(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	apiKeys, err := kc.apiKeyService.ListAPIKeys(authUser.ID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": apiKeys,
+	})
+}
+
+func (kc *APIKeyController) GetAPIKey(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	apiKey, err := kc.apiKeyService.GetAPIKey(authUser.ID, c.Param("id"))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_key": apiKey,
+	})
+}
+
+// CreateAPIKey creates an API key for the current user, the key is only returned here
+func (kc *APIKeyController) CreateAPIKey(c *gin.Context) {
+	var req types.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := kc.apiKeyService.CreateAPIKey(authUser.ID, &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+func (kc *APIKeyController) UpdateAPIKey(c *gin.Context) {
+	var req types.UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	apiKey, err := kc.apiKeyService.UpdateAPIKey(authUser.ID, c.Param("id"), &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_key": apiKey,
+	})
+}
+
+// DeleteAPIKey removes an API key of the current user, it is refused from then on
+func (kc *APIKeyController) DeleteAPIKey(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := kc.apiKeyService.DeleteAPIKey(authUser.ID, c.Param("id")); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
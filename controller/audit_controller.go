@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"log"
+	"net/http"
+)
+
+type AuditController struct {
+	auditService *services.AuditService
+}
+
+func NewAuditController() *AuditController {
+	return &AuditController{
+		auditService: services.NewAuditService(),
+	}
+}
+
+// ListEvents pages through the audit log, newest first
+func (ac *AuditController) ListEvents(c *gin.Context) {
+	var query types.ListAuditEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	events, err := ac.auditService.ListEvents(&query)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// ExportEvents streams the matching audit events as JSON lines, oldest first
+func (ac *AuditController) ExportEvents(c *gin.Context) {
+	var query types.ExportAuditEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-events.jsonl"`)
+	c.Status(http.StatusOK)
+
+	// The status is already sent, a failure can only cut the export short
+	if err := ac.auditService.ExportEvents(&query, c.Writer); err != nil {
+		log.Println("Failed to export audit events:", err)
+	}
+}
+
+// VerifyChain checks that no audit event was changed or removed
+func (ac *AuditController) VerifyChain(c *gin.Context) {
+	result, err := ac.auditService.VerifyChain()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -1,11 +1,15 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"io"
+	"jwt-auth-app/middleware"
 	"jwt-auth-app/services"
 	"jwt-auth-app/types"
 	"jwt-auth-app/utils"
 	"net/http"
+	"strconv"
 )
 
 type AuthController struct {
@@ -28,7 +32,7 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	response, err := ac.authService.Register(&req)
+	response, err := ac.authService.Register(&req, middleware.GetClientInfo(c))
 	if err != nil {
 		status, errResponse := utils.GetErrorResponse(err)
 		c.JSON(status, errResponse)
@@ -48,9 +52,10 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := ac.authService.Login(&req)
+	response, err := ac.authService.Login(&req, middleware.GetClientInfo(c))
 	if err != nil {
 		status, errResponse := utils.GetErrorResponse(err)
+		setRetryAfter(c, errResponse)
 		c.JSON(status, errResponse)
 		return
 	}
@@ -58,6 +63,13 @@ func (ac *AuthController) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// setRetryAfter mirrors the retry_after of locked out attempts in the Retry-After header
+func setRetryAfter(c *gin.Context, errResponse types.ErrorResponse) {
+	if errResponse.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.FormatInt(errResponse.RetryAfter, 10))
+	}
+}
+
 func (ac *AuthController) RefreshToken(c *gin.Context) {
 	var input types.RefreshTokenInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -68,25 +80,164 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	metadata, err := utils.ValidateRefreshToken(input.RefreshToken)
+	tokenPair, err := ac.authService.RefreshToken(input.RefreshToken, middleware.GetClientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-			Code:    "INVALID_REFRESH_TOKEN",
-			Message: "Invalid refresh token",
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenPair)
+}
+
+// Logout revokes the current access token and, if provided, its refresh token
+func (ac *AuthController) Logout(c *gin.Context) {
+	var req types.LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// Generate new token pair
-	tokenPair, err := utils.GenerateTokenPair(metadata.UserID)
+	metadata, err := middleware.GetTokenMetadata(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Code:    "TOKEN_GENERATION_FAILED",
-			Message: "Failed to generate new tokens",
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := ac.authService.Logout(metadata, req.RefreshToken); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll revokes every token issued to the current user. Service accounts
+// have no user and are refused.
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := ac.authService.LogoutAll(authUser.ID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ForgotPassword emails a password reset link. It answers the same way whether
+// or not the email address is registered.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req types.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, tokenPair)
+	if err := ac.authService.ForgotPassword(req.Email); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the email address is registered, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req types.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := ac.authService.ResetPassword(req.Token, req.Password); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// VerifyEmail confirms the email address with a token from the verification email
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req types.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := ac.authService.VerifyEmail(req.Token); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ConfirmEmailChange swaps the email address of the user for the one the link was sent to
+func (ac *AuthController) ConfirmEmailChange(c *gin.Context) {
+	var req types.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := ac.authService.ConfirmEmailChange(req.Token); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ResendVerification emails a new verification link. It answers the same way
+// whether or not the email address is registered.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req types.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := ac.authService.ResendVerification(req.Email); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the email address is registered and not verified yet, a verification link has been sent",
+	})
 }
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+)
+
+// VerifyMFA exchanges the mfa_token returned by Login and a TOTP or recovery
+// code for the token pair
+func (ac *AuthController) VerifyMFA(c *gin.Context) {
+	var req types.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := ac.authService.VerifyMFA(req.MFAToken, req.Code, middleware.GetClientInfo(c))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		setRetryAfter(c, errResponse)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// EnrollTOTP starts a TOTP enrollment and returns the secret to add to an authenticator app
+func (ac *AuthController) EnrollTOTP(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := ac.authService.EnrollTOTP(authUser.ID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery codes
+func (ac *AuthController) ConfirmTOTP(c *gin.Context) {
+	var req types.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	codes, err := ac.authService.ConfirmTOTP(authUser.ID, req.Code)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off
+func (ac *AuthController) DisableTOTP(c *gin.Context) {
+	var req types.DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := ac.authService.DisableTOTP(authUser.ID, req.Password, req.Code); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req types.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	codes, err := ac.authService.RegenerateRecoveryCodes(authUser.ID, req.Code)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+)
+
+type OAuthClientController struct {
+	clientService *services.OAuthClientService
+}
+
+func NewOAuthClientController() *OAuthClientController {
+	return &OAuthClientController{
+		clientService: services.NewOAuthClientService(),
+	}
+}
+
+func (oc *OAuthClientController) ListClients(c *gin.Context) {
+	clients, err := oc.clientService.ListClients()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clients": clients,
+	})
+}
+
+func (oc *OAuthClientController) GetClient(c *gin.Context) {
+	client, err := oc.clientService.GetClient(c.Param("id"))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client": client,
+	})
+}
+
+// CreateClient registers a client, the secret of a confidential client is only returned here
+func (oc *OAuthClientController) CreateClient(c *gin.Context) {
+	var req types.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := oc.clientService.CreateClient(actor.ID, &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+func (oc *OAuthClientController) UpdateClient(c *gin.Context) {
+	var req types.UpdateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	client, err := oc.clientService.UpdateClient(actor.ID, c.Param("id"), &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client": client,
+	})
+}
+
+// RotateSecret issues a new secret to a confidential client
+func (oc *OAuthClientController) RotateSecret(c *gin.Context) {
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := oc.clientService.RotateSecret(actor.ID, c.Param("id"))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteClient removes a client and revokes the sessions it started
+func (oc *OAuthClientController) DeleteClient(c *gin.Context) {
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := oc.clientService.DeleteClient(actor.ID, c.Param("id")); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+	"net/url"
+)
+
+type OAuthController struct {
+	authService *services.AuthService
+}
+
+func NewOAuthController() *OAuthController {
+	return &OAuthController{
+		authService: services.NewAuthService(),
+	}
+}
+
+// Authorize starts the authorization code flow. The user is sent to the
+// consent page, or back to the client when the request is invalid.
+func (oc *OAuthController) Authorize(c *gin.Context) {
+	var req types.OAuthAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	redirectURI, err := oc.authService.Authorize(&req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirectURI)
+}
+
+// GetConsent describes the client of an authorization request for the consent page
+func (oc *OAuthController) GetConsent(c *gin.Context) {
+	var req types.OAuthAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	metadata, err := middleware.GetTokenMetadata(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	consent, err := oc.authService.GetConsent(metadata, &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, consent)
+}
+
+// Consent records the decision of the current user and returns where to send
+// them back to the client
+func (oc *OAuthController) Consent(c *gin.Context) {
+	var req types.OAuthConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	metadata, err := middleware.GetTokenMetadata(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	redirectURI, err := oc.authService.Consent(metadata, &req, middleware.GetClientInfo(c))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.OAuthRedirectResponse{RedirectURI: redirectURI})
+}
+
+// Token exchanges an authorization code or a refresh token for a token pair,
+// or the credentials of a service account for an access token. Requests and
+// responses follow RFC 6749 rather than the rest of the API.
+func (oc *OAuthController) Token(c *gin.Context) {
+	// Token responses must not be cached, RFC 6749 section 5.1
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req types.OAuthTokenRequest
+	if err := c.ShouldBindWith(&req, binding.FormPost); err != nil {
+		c.JSON(http.StatusBadRequest, types.OAuthErrorResponse{
+			Error:            utils.OAuthInvalidRequest,
+			ErrorDescription: err.Error(),
+		})
+		return
+	}
+
+	// The credentials of HTTP Basic are form encoded first, RFC 6749 section 2.3.1
+	clientID, clientSecret, basicAuth := c.Request.BasicAuth()
+	if basicAuth {
+		if req.ClientSecret != "" || req.ClientAssertion != "" {
+			c.JSON(http.StatusBadRequest, types.OAuthErrorResponse{
+				Error:            utils.OAuthInvalidRequest,
+				ErrorDescription: "Use only one client authentication method",
+			})
+			return
+		}
+
+		var idErr, secretErr error
+		req.ClientID, idErr = url.QueryUnescape(clientID)
+		req.ClientSecret, secretErr = url.QueryUnescape(clientSecret)
+		if idErr != nil || secretErr != nil {
+			c.JSON(http.StatusBadRequest, types.OAuthErrorResponse{
+				Error:            utils.OAuthInvalidRequest,
+				ErrorDescription: "Invalid client credentials encoding",
+			})
+			return
+		}
+	}
+
+	response, err := oc.authService.Token(&req, middleware.GetClientInfo(c))
+	if err != nil {
+		status, errResponse := utils.GetOAuthErrorResponse(err)
+		if status == http.StatusUnauthorized && basicAuth {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UserInfo returns the claims about the user allowed by the scope of the
+// access token. Errors follow RFC 6750 section 3.
+func (oc *OAuthController) UserInfo(c *gin.Context) {
+	metadata, err := middleware.GetTokenMetadata(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	userInfo, err := oc.authService.UserInfo(metadata)
+	if err != nil {
+		status, errResponse := utils.GetOAuthErrorResponse(err)
+		if status == http.StatusForbidden {
+			c.Header("WWW-Authenticate", `Bearer error="`+errResponse.Error+`"`)
+		}
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, userInfo)
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+	"strconv"
+)
+
+type RBACController struct {
+	rbacService *services.RBACService
+}
+
+func NewRBACController() *RBACController {
+	return &RBACController{
+		rbacService: services.NewRBACService(),
+	}
+}
+
+func (rc *RBACController) ListRoles(c *gin.Context) {
+	roles, err := rc.rbacService.ListRoles()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": roles,
+	})
+}
+
+func (rc *RBACController) CreateRole(c *gin.Context) {
+	var req types.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	role, err := rc.rbacService.CreateRole(&req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"role": role,
+	})
+}
+
+func (rc *RBACController) DeleteRole(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := rc.rbacService.DeleteRole(roleID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (rc *RBACController) GrantPermission(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	permissionID, ok := parseIDParam(c, "permissionId")
+	if !ok {
+		return
+	}
+
+	role, err := rc.rbacService.GrantPermission(roleID, permissionID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role": role,
+	})
+}
+
+func (rc *RBACController) RevokePermission(c *gin.Context) {
+	roleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	permissionID, ok := parseIDParam(c, "permissionId")
+	if !ok {
+		return
+	}
+
+	role, err := rc.rbacService.RevokePermission(roleID, permissionID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role": role,
+	})
+}
+
+func (rc *RBACController) ListPermissions(c *gin.Context) {
+	permissions, err := rc.rbacService.ListPermissions()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"permissions": permissions,
+	})
+}
+
+func (rc *RBACController) CreatePermission(c *gin.Context) {
+	var req types.CreatePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	permission, err := rc.rbacService.CreatePermission(&req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"permission": permission,
+	})
+}
+
+func (rc *RBACController) DeletePermission(c *gin.Context) {
+	permissionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := rc.rbacService.DeletePermission(permissionID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (rc *RBACController) GetUserRoles(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	roles, err := rc.rbacService.GetUserRoles(userID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": roles,
+	})
+}
+
+func (rc *RBACController) AssignRole(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	roleID, ok := parseIDParam(c, "roleId")
+	if !ok {
+		return
+	}
+
+	if err := rc.rbacService.AssignRole(userID, roleID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (rc *RBACController) UnassignRole(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	roleID, ok := parseIDParam(c, "roleId")
+	if !ok {
+		return
+	}
+
+	if err := rc.rbacService.UnassignRole(userID, roleID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseIDParam reads a numeric path parameter, writing a 400 response when it is invalid
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: "Invalid " + name,
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
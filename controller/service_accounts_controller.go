@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+)
+
+type ServiceAccountController struct {
+	accountService *services.ServiceAccountService
+}
+
+func NewServiceAccountController() *ServiceAccountController {
+	return &ServiceAccountController{
+		accountService: services.NewServiceAccountService(),
+	}
+}
+
+func (sc *ServiceAccountController) ListServiceAccounts(c *gin.Context) {
+	accounts, err := sc.accountService.ListServiceAccounts()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"service_accounts": accounts,
+	})
+}
+
+func (sc *ServiceAccountController) GetServiceAccount(c *gin.Context) {
+	account, err := sc.accountService.GetServiceAccount(c.Param("id"))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"service_account": account,
+	})
+}
+
+// CreateServiceAccount registers a service account, its secret is only returned here
+func (sc *ServiceAccountController) CreateServiceAccount(c *gin.Context) {
+	var req types.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := sc.accountService.CreateServiceAccount(actor.ID, &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+func (sc *ServiceAccountController) UpdateServiceAccount(c *gin.Context) {
+	var req types.UpdateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	account, err := sc.accountService.UpdateServiceAccount(actor.ID, c.Param("id"), &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"service_account": account,
+	})
+}
+
+// RotateSecret issues a new secret to a service account that authenticates with one
+func (sc *ServiceAccountController) RotateSecret(c *gin.Context) {
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := sc.accountService.RotateSecret(actor.ID, c.Param("id"))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteServiceAccount removes a service account, its access tokens are refused from then on
+func (sc *ServiceAccountController) DeleteServiceAccount(c *gin.Context) {
+	actor, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := sc.accountService.DeleteServiceAccount(actor.ID, c.Param("id")); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
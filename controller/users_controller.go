@@ -11,11 +11,13 @@ import (
 
 type UserController struct {
 	usersService *services.UsersService
+	authService  *services.AuthService
 }
 
 func NewUserController() *UserController {
 	return &UserController{
 		usersService: services.NewUsersService(),
+		authService:  services.NewAuthService(),
 	}
 }
 
@@ -36,11 +38,7 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 		return
 	}
 
-	userResponse := types.UserResponse{
-		ID:    user.ID,
-		Email: user.Email,
-		Name:  user.Name,
-	}
+	userResponse := services.ToUserResponse(user)
 
 	c.JSON(http.StatusOK, gin.H{
 		"profile": userResponse,
@@ -75,3 +73,127 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 		"profile": updatedUser,
 	})
 }
+
+// DeleteAccount soft-deletes the authenticated user and signs them out everywhere
+func (uc *UserController) DeleteAccount(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := uc.usersService.DeleteAccount(authUser.ID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangePassword sets a new password and returns a new token pair, every other session is revoked
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	var req types.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	tokens, err := uc.authService.ChangePassword(authUser.ID, &req, middleware.GetClientInfo(c))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		setRetryAfter(c, errResponse)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+	})
+}
+
+// ChangeEmail emails a confirmation link to the new address, the address
+// changes once it is confirmed
+func (uc *UserController) ChangeEmail(c *gin.Context) {
+	var req types.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := uc.authService.RequestEmailChange(authUser.ID, &req); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		setRetryAfter(c, errResponse)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "A confirmation link has been sent to the new email address",
+	})
+}
+
+// ListSessions lists the devices the current user is logged in on
+func (uc *UserController) ListSessions(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	metadata, err := middleware.GetTokenMetadata(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	sessions, err := uc.authService.ListSessions(authUser.ID, metadata.SessionID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession logs the current user out of one of their sessions
+func (uc *UserController) RevokeSession(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := uc.authService.RevokeSession(authUser.ID, c.Param("id")); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
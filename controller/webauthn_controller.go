@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/middleware"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+)
+
+// BeginWebAuthnRegistration returns the options to create a passkey for the current user
+func (ac *AuthController) BeginWebAuthnRegistration(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	response, err := ac.authService.BeginWebAuthnRegistration(authUser.ID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// FinishWebAuthnRegistration stores the passkey created by the browser
+func (ac *AuthController) FinishWebAuthnRegistration(c *gin.Context) {
+	var req types.WebAuthnRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	credential, err := ac.authService.FinishWebAuthnRegistration(authUser.ID, &req)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// BeginWebAuthnLogin returns the options to sign in with a passkey
+func (ac *AuthController) BeginWebAuthnLogin(c *gin.Context) {
+	response, err := ac.authService.BeginWebAuthnLogin()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// FinishWebAuthnLogin verifies the passkey assertion and returns the token pair
+func (ac *AuthController) FinishWebAuthnLogin(c *gin.Context) {
+	var req types.WebAuthnLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := ac.authService.FinishWebAuthnLogin(&req, middleware.GetClientInfo(c))
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListWebAuthnCredentials lists the passkeys of the current user
+func (ac *AuthController) ListWebAuthnCredentials(c *gin.Context) {
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	credentials, err := ac.authService.ListWebAuthnCredentials(authUser.ID)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// DeleteWebAuthnCredential removes a passkey of the current user
+func (ac *AuthController) DeleteWebAuthnCredential(c *gin.Context) {
+	credentialID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	authUser, err := middleware.GetAuthUser(c)
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	if err := ac.authService.DeleteWebAuthnCredential(authUser.ID, credentialID); err != nil {
+		status, errResponse := utils.GetErrorResponse(err)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/config"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/http"
+	"strings"
+)
+
+// wellKnownCacheControl lets verifiers cache the documents while still picking
+// up rotated keys within a few minutes
+const wellKnownCacheControl = "public, max-age=300"
+
+type WellKnownController struct {
+	issuer    string
+	algorithm string
+}
+
+func NewWellKnownController() *WellKnownController {
+	return &WellKnownController{
+		issuer:    config.AppConfig.JWT.Issuer,
+		algorithm: config.AppConfig.JWT.Algorithm,
+	}
+}
+
+// JWKS serves the public keys used to verify access tokens
+func (wc *WellKnownController) JWKS(c *gin.Context) {
+	jwks, err := utils.GetAccessJWKS()
+	if err != nil {
+		status, errResponse := utils.GetErrorResponse(utils.ErrInternalServer)
+		c.JSON(status, errResponse)
+		return
+	}
+
+	c.Header("Cache-Control", wellKnownCacheControl)
+	c.JSON(http.StatusOK, jwks)
+}
+
+// OpenIDConfiguration serves the discovery document pointing at the JWKS and
+// the OAuth and OpenID Connect endpoints. ID tokens are signed like access tokens.
+func (wc *WellKnownController) OpenIDConfiguration(c *gin.Context) {
+	c.Header("Cache-Control", wellKnownCacheControl)
+	c.JSON(http.StatusOK, types.OpenIDConfiguration{
+		Issuer:                            wc.issuer,
+		JWKSURI:                           wc.url("/.well-known/jwks.json"),
+		AuthorizationEndpoint:             wc.url("/oauth/authorize"),
+		TokenEndpoint:                     wc.url("/oauth/token"),
+		UserinfoEndpoint:                  wc.url("/oauth/userinfo"),
+		ScopesSupported:                   services.ScopesSupported(),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{services.GrantTypeAuthorizationCode, services.GrantTypeRefreshToken, services.GrantTypeClientCredentials},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post", services.AuthMethodPrivateKeyJWT},
+		TokenEndpointAuthSigningAlgValuesSupported: utils.ClientAssertionAlgorithms,
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{wc.algorithm},
+		ClaimsSupported:                            services.SupportedClaims,
+	})
+}
+
+func (wc *WellKnownController) url(path string) string {
+	return strings.TrimSuffix(wc.issuer, "/") + path
+}
@@ -7,8 +7,13 @@ import (
 	"jwt-auth-app/controller"
 	"jwt-auth-app/middleware"
 	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/mailer"
+	"jwt-auth-app/utils/ratelimit"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -23,30 +28,126 @@ func main() {
 		log.Fatal("Failed to initialize JWT keys:", err)
 	}
 
+	// Reload JWT keys on SIGHUP so a new signing key can be promoted without a restart
+	go reloadJWTKeysOnSignal()
+
+	// Initialize the password hashing and policy
+	if err := utils.InitializePasswordManager(&config.AppConfig.Password); err != nil {
+		log.Fatal("Failed to initialize password hashing:", err)
+	}
+	if err := utils.InitializePasswordPolicy(&config.AppConfig.Password); err != nil {
+		log.Fatal("Failed to initialize password policy:", err)
+	}
+
+	// Initialize the mailer used for password reset and verification emails
+	if err := mailer.InitializeMailer(&config.AppConfig.Mail); err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+
+	// Initialize the WebAuthn relying party used for passkeys
+	if err := utils.InitializeWebAuthn(&config.AppConfig.WebAuthn); err != nil {
+		log.Fatal("Failed to initialize WebAuthn:", err)
+	}
+
+	// Initialize the store shared by the rate limiters
+	rateLimitStore, err := ratelimit.New(&config.AppConfig.RateLimit)
+	if err != nil {
+		log.Fatal("Failed to initialize rate limit store:", err)
+	}
+
 	// Initialize Middleware
 	authMiddleware := middleware.NewAuthMiddleware()
 
+	rateLimits := config.AppConfig.RateLimit
+	loginByIP := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "login-ip", rateLimits.Login), middleware.RateLimitByIP)
+	loginByEmail := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "login-email", rateLimits.Login), middleware.RateLimitByEmail)
+	registerByIP := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "register", rateLimits.Register), middleware.RateLimitByIP)
+	refreshByIP := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "refresh", rateLimits.Refresh), middleware.RateLimitByIP)
+	emailByAddress := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "email", rateLimits.Email), middleware.RateLimitByEmail)
+	mfaByIP := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "mfa-ip", rateLimits.MFA), middleware.RateLimitByIP)
+	mfaByUser := middleware.RateLimit(ratelimit.NewLimiter(rateLimitStore, "mfa-user", rateLimits.MFA), middleware.RateLimitByUser)
+
+	// API keys and OAuth clients cannot manage the sessions and credentials of the account
+	sessionOnly := authMiddleware.RequireFirstParty()
+
 	// Initialize Controllers
 	authController := controller.NewAuthController()
 	userController := controller.NewUserController()
+	wellKnownController := controller.NewWellKnownController()
+	rbacController := controller.NewRBACController()
+	adminUsersController := controller.NewAdminUsersController()
+	auditController := controller.NewAuditController()
+	oauthController := controller.NewOAuthController()
+	oauthClientController := controller.NewOAuthClientController()
+	serviceAccountController := controller.NewServiceAccountController()
+	apiKeyController := controller.NewAPIKeyController()
 
 	// Create Gin router
 	r := gin.Default()
+	if err := r.SetTrustedProxies(config.AppConfig.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "Hello, World!",
 		})
 	})
 
+	// Discovery routes
+	wellKnown := r.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", wellKnownController.JWKS)
+		wellKnown.GET("/openid-configuration", wellKnownController.OpenIDConfiguration)
+	}
+
+	// OAuth 2.0 authorization server
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", oauthController.Authorize)
+		oauth.GET("/consent", authMiddleware.JWT(), sessionOnly, oauthController.GetConsent)
+		oauth.POST("/consent", authMiddleware.JWT(), sessionOnly, oauthController.Consent)
+		oauth.POST("/token", refreshByIP, oauthController.Token)
+		oauth.GET("/userinfo", authMiddleware.JWT(), oauthController.UserInfo)
+		oauth.POST("/userinfo", authMiddleware.JWT(), oauthController.UserInfo)
+	}
+
 	// API routes
 	api := r.Group("/api/v1")
 	{
 		// Public routes
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", authController.Register)
-			auth.POST("/login", authController.Login)
-			auth.POST("/refresh", authController.RefreshToken)
+			auth.POST("/register", registerByIP, authController.Register)
+			auth.POST("/login", loginByIP, loginByEmail, authController.Login)
+			auth.POST("/refresh", refreshByIP, authController.RefreshToken)
+			auth.POST("/password/forgot", emailByAddress, authController.ForgotPassword)
+			auth.POST("/password/reset", loginByIP, authController.ResetPassword)
+			auth.POST("/verify-email", loginByIP, authController.VerifyEmail)
+			auth.POST("/verify-email/resend", emailByAddress, authController.ResendVerification)
+			auth.POST("/email/confirm", loginByIP, authController.ConfirmEmailChange)
+			auth.POST("/logout", authMiddleware.JWT(), sessionOnly, authController.Logout)
+			auth.POST("/logout-all", authMiddleware.JWT(), sessionOnly, authController.LogoutAll)
+
+			// Two-factor authentication
+			mfa := auth.Group("/mfa")
+			{
+				mfa.POST("/verify", mfaByIP, authController.VerifyMFA)
+				mfa.POST("/totp/enroll", authMiddleware.JWT(), sessionOnly, authController.EnrollTOTP)
+				mfa.POST("/totp/confirm", authMiddleware.JWT(), sessionOnly, mfaByUser, authController.ConfirmTOTP)
+				mfa.POST("/totp/disable", authMiddleware.JWT(), sessionOnly, mfaByUser, authController.DisableTOTP)
+				mfa.POST("/recovery-codes", authMiddleware.JWT(), sessionOnly, mfaByUser, authController.RegenerateRecoveryCodes)
+			}
+
+			// Passkeys
+			webAuthn := auth.Group("/webauthn")
+			{
+				webAuthn.POST("/login/begin", loginByIP, authController.BeginWebAuthnLogin)
+				webAuthn.POST("/login/finish", loginByIP, authController.FinishWebAuthnLogin)
+				webAuthn.POST("/register/begin", authMiddleware.JWT(), sessionOnly, authController.BeginWebAuthnRegistration)
+				webAuthn.POST("/register/finish", authMiddleware.JWT(), sessionOnly, authController.FinishWebAuthnRegistration)
+				webAuthn.GET("/credentials", authMiddleware.JWT(), sessionOnly, authController.ListWebAuthnCredentials)
+				webAuthn.DELETE("/credentials/:id", authMiddleware.JWT(), sessionOnly, authController.DeleteWebAuthnCredential)
+			}
 		}
 
 		// Protected routes
@@ -56,8 +157,79 @@ func main() {
 			// User routes
 			users := protected.Group("/users")
 			{
-				users.GET("/profile", userController.GetProfile)
-				users.PUT("/profile", userController.UpdateProfile)
+				users.GET("/profile", authMiddleware.RequireScope("profile:read"), authMiddleware.RequirePermission("profile:read"), userController.GetProfile)
+				users.PUT("/profile", authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), userController.UpdateProfile)
+				users.DELETE("/me", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), userController.DeleteAccount)
+				users.PUT("/me/password", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), userController.ChangePassword)
+				users.PUT("/me/email", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), userController.ChangeEmail)
+				users.GET("/me/sessions", sessionOnly, authMiddleware.RequireScope("profile:read"), authMiddleware.RequirePermission("profile:read"), userController.ListSessions)
+				users.DELETE("/me/sessions/:id", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), userController.RevokeSession)
+				users.GET("/me/api-keys", sessionOnly, authMiddleware.RequireScope("profile:read"), authMiddleware.RequirePermission("profile:read"), apiKeyController.ListAPIKeys)
+				users.POST("/me/api-keys", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), apiKeyController.CreateAPIKey)
+				users.GET("/me/api-keys/:id", sessionOnly, authMiddleware.RequireScope("profile:read"), authMiddleware.RequirePermission("profile:read"), apiKeyController.GetAPIKey)
+				users.PUT("/me/api-keys/:id", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), apiKeyController.UpdateAPIKey)
+				users.DELETE("/me/api-keys/:id", sessionOnly, authMiddleware.RequireScope("profile:write"), authMiddleware.RequirePermission("profile:write"), apiKeyController.DeleteAPIKey)
+			}
+
+			// Admin routes
+			admin := protected.Group("/admin")
+			{
+				roles := admin.Group("/roles")
+				{
+					roles.GET("", authMiddleware.RequirePermission("roles:read"), rbacController.ListRoles)
+					roles.POST("", authMiddleware.RequirePermission("roles:write"), rbacController.CreateRole)
+					roles.DELETE("/:id", authMiddleware.RequirePermission("roles:write"), rbacController.DeleteRole)
+					roles.PUT("/:id/permissions/:permissionId", authMiddleware.RequirePermission("roles:write"), rbacController.GrantPermission)
+					roles.DELETE("/:id/permissions/:permissionId", authMiddleware.RequirePermission("roles:write"), rbacController.RevokePermission)
+				}
+
+				permissions := admin.Group("/permissions")
+				{
+					permissions.GET("", authMiddleware.RequirePermission("roles:read"), rbacController.ListPermissions)
+					permissions.POST("", authMiddleware.RequirePermission("roles:write"), rbacController.CreatePermission)
+					permissions.DELETE("/:id", authMiddleware.RequirePermission("roles:write"), rbacController.DeletePermission)
+				}
+
+				adminUsers := admin.Group("/users", authMiddleware.RequireRole("admin"))
+				{
+					adminUsers.GET("", authMiddleware.RequireScope("users:read"), authMiddleware.RequirePermission("users:read"), adminUsersController.ListUsers)
+					adminUsers.GET("/:id", authMiddleware.RequireScope("users:read"), authMiddleware.RequirePermission("users:read"), adminUsersController.GetUser)
+					adminUsers.PUT("/:id/role", authMiddleware.RequireScope("users:write"), authMiddleware.RequirePermission("users:write"), adminUsersController.ChangeRole)
+					adminUsers.PUT("/:id/status", authMiddleware.RequireScope("users:write"), authMiddleware.RequirePermission("users:write"), adminUsersController.ChangeStatus)
+					adminUsers.POST("/:id/force-password-reset", authMiddleware.RequireScope("users:write"), authMiddleware.RequirePermission("users:write"), adminUsersController.ForcePasswordReset)
+					adminUsers.POST("/:id/unlock", authMiddleware.RequireScope("users:write"), authMiddleware.RequirePermission("users:write"), adminUsersController.UnlockUser)
+					adminUsers.DELETE("/:id", authMiddleware.RequireScope("users:write"), authMiddleware.RequirePermission("users:write"), adminUsersController.DeleteUser)
+					adminUsers.GET("/:id/roles", authMiddleware.RequirePermission("roles:read"), rbacController.GetUserRoles)
+					adminUsers.PUT("/:id/roles/:roleId", authMiddleware.RequirePermission("roles:write"), rbacController.AssignRole)
+					adminUsers.DELETE("/:id/roles/:roleId", authMiddleware.RequirePermission("roles:write"), rbacController.UnassignRole)
+				}
+
+				auditEvents := admin.Group("/audit-events", authMiddleware.RequirePermission("audit:read"))
+				{
+					auditEvents.GET("", auditController.ListEvents)
+					auditEvents.GET("/export", auditController.ExportEvents)
+					auditEvents.GET("/verify", auditController.VerifyChain)
+				}
+
+				oauthClients := admin.Group("/oauth-clients")
+				{
+					oauthClients.GET("", authMiddleware.RequirePermission("oauth_clients:read"), oauthClientController.ListClients)
+					oauthClients.POST("", authMiddleware.RequirePermission("oauth_clients:write"), oauthClientController.CreateClient)
+					oauthClients.GET("/:id", authMiddleware.RequirePermission("oauth_clients:read"), oauthClientController.GetClient)
+					oauthClients.PUT("/:id", authMiddleware.RequirePermission("oauth_clients:write"), oauthClientController.UpdateClient)
+					oauthClients.DELETE("/:id", authMiddleware.RequirePermission("oauth_clients:write"), oauthClientController.DeleteClient)
+					oauthClients.POST("/:id/secret", authMiddleware.RequirePermission("oauth_clients:write"), oauthClientController.RotateSecret)
+				}
+
+				serviceAccounts := admin.Group("/service-accounts")
+				{
+					serviceAccounts.GET("", authMiddleware.RequirePermission("service_accounts:read"), serviceAccountController.ListServiceAccounts)
+					serviceAccounts.POST("", authMiddleware.RequirePermission("service_accounts:write"), serviceAccountController.CreateServiceAccount)
+					serviceAccounts.GET("/:id", authMiddleware.RequirePermission("service_accounts:read"), serviceAccountController.GetServiceAccount)
+					serviceAccounts.PUT("/:id", authMiddleware.RequirePermission("service_accounts:write"), serviceAccountController.UpdateServiceAccount)
+					serviceAccounts.DELETE("/:id", authMiddleware.RequirePermission("service_accounts:write"), serviceAccountController.DeleteServiceAccount)
+					serviceAccounts.POST("/:id/secret", authMiddleware.RequirePermission("service_accounts:write"), serviceAccountController.RotateSecret)
+				}
 			}
 
 			// Token info route
@@ -83,3 +255,23 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+func reloadJWTKeysOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		jwtConfig, err := config.ReloadJWTConfig()
+		if err != nil {
+			log.Println("Failed to reload JWT config:", err)
+			continue
+		}
+
+		if err := utils.ReloadJWTKeys(&jwtConfig); err != nil {
+			log.Println("Failed to reload JWT keys:", err)
+			continue
+		}
+
+		log.Println("JWT keys reloaded")
+	}
+}
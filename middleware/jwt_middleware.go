@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"jwt-auth-app/model"
 	"jwt-auth-app/services"
 	"jwt-auth-app/types"
 	"jwt-auth-app/utils"
@@ -11,17 +14,27 @@ import (
 
 // AuthMiddleware contains the dependencies for the auth middleware
 type AuthMiddleware struct {
-	usersService *services.UsersService
+	usersService    *services.UsersService
+	serviceAccounts *services.ServiceAccountService
+	apiKeys         *services.APIKeyService
+	rbacService     *services.RBACService
+	auditor         services.Auditor
 }
 
 // NewAuthMiddleware creates a new auth middleware instance
 func NewAuthMiddleware() *AuthMiddleware {
 	return &AuthMiddleware{
-		usersService: services.NewUsersService(),
+		usersService:    services.NewUsersService(),
+		serviceAccounts: services.NewServiceAccountService(),
+		apiKeys:         services.NewAPIKeyService(),
+		rbacService:     services.NewRBACService(),
+		auditor:         services.NewAuditor(),
 	}
 }
 
-// JWT middleware verifies the access token and loads the user into the context
+// JWT middleware verifies the access token and loads its principal into the
+// context, the user or the service account it was issued to. API keys are
+// accepted too and load their user.
 func (m *AuthMiddleware) JWT() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token, err := extractToken(c)
@@ -34,34 +47,327 @@ func (m *AuthMiddleware) JWT() gin.HandlerFunc {
 			return
 		}
 
-		// Validate token and get user
-		authenticatedUser, tokenMetadata, err := m.usersService.ValidateAndGetUser(token)
+		if services.IsAPIKey(token) {
+			m.authenticateAPIKey(c, token)
+			return
+		}
+
+		tokenMetadata, err := utils.ValidateAccessToken(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-				Code:    "INVALID_TOKEN",
-				Message: err.Error(),
-			})
-			c.Abort()
+			m.rejectToken(c, nil, utils.ErrInvalidToken)
 			return
 		}
 
-		// Store user and token metadata in context
-		c.Set(string(UserContextKey), *authenticatedUser)
+		// Store the principal and token metadata in context
+		if tokenMetadata.ServiceAccountID != "" {
+			serviceAccount, err := m.serviceAccounts.GetTokenServiceAccount(tokenMetadata)
+			if err != nil {
+				m.rejectToken(c, tokenMetadata, err)
+				return
+			}
+			c.Set(string(ServiceAccountContextKey), *serviceAccount)
+		} else {
+			authenticatedUser, err := m.usersService.GetTokenUser(tokenMetadata)
+			if err != nil {
+				m.rejectToken(c, tokenMetadata, err)
+				return
+			}
+			c.Set(string(UserContextKey), *authenticatedUser)
+		}
 		c.Set(string(TokenMetadataKey), tokenMetadata)
 
 		c.Next()
 	}
 }
 
-// RequireRole middleware checks if the user has the required role
+// authenticateAPIKey loads the user of an API key into the context, with the
+// token metadata the key stands for
+func (m *AuthMiddleware) authenticateAPIKey(c *gin.Context, key string) {
+	authenticatedUser, tokenMetadata, err := m.apiKeys.AuthenticateAPIKey(key)
+	if err != nil {
+		m.rejectToken(c, tokenMetadata, err)
+		return
+	}
+
+	c.Set(string(UserContextKey), *authenticatedUser)
+	c.Set(string(TokenMetadataKey), tokenMetadata)
+
+	c.Next()
+}
+
+// rejectToken refuses the request of an access token. Tokens refused after
+// their signature was verified are audited.
+func (m *AuthMiddleware) rejectToken(c *gin.Context, tokenMetadata *types.TokenMetadata, err error) {
+	if errors.Is(err, utils.ErrTokenRevoked) || errors.Is(err, utils.ErrAccountDisabled) || errors.Is(err, utils.ErrAccountDeleted) {
+		status, errResponse := utils.GetErrorResponse(err)
+		m.audit(c, model.AuditTokenRejected, tokenMetadata, map[string]interface{}{
+			"reason": errResponse.Code,
+		})
+		c.JSON(status, errResponse)
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+		Code:    "INVALID_TOKEN",
+		Message: err.Error(),
+	})
+	c.Abort()
+}
+
+// RequireRole middleware checks if the user or service account has one of the
+// required roles. Roles are hierarchical, so a super_admin also passes
+// RequireRole("admin"). Scopes cannot narrow a role, so API keys and the access
+// tokens of OAuth clients limited to scopes are refused.
 func (m *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
+	for _, role := range roles {
+		if !model.UserRole(role).IsValid() {
+			panic(fmt.Sprintf("RequireRole: unknown role %q", role))
+		}
+	}
+
+	return func(c *gin.Context) {
+		principalRole, err := getPrincipalRole(c)
+		if err == nil {
+			err = requireVerifiedEmail(c)
+		}
+		if err != nil {
+			status, errResponse := utils.GetErrorResponse(err)
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
+		tokenMetadata, _ := GetTokenMetadata(c)
+		if reason := delegatedTokenReason(tokenMetadata); reason != "" && tokenMetadata.Scopes != nil {
+			m.audit(c, model.AuditAccessDenied, tokenMetadata, map[string]interface{}{
+				"required_roles": roles,
+				"reason":         reason,
+			})
+			status, errResponse := utils.GetErrorResponse(utils.ErrForbidden)
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
+		userRole := model.UserRole(principalRole)
+		for _, role := range roles {
+			if userRole.Includes(model.UserRole(role)) {
+				c.Next()
+				return
+			}
+		}
+
+		m.audit(c, model.AuditAccessDenied, tokenMetadata, map[string]interface{}{
+			"required_roles": roles,
+		})
+		status, errResponse := utils.GetErrorResponse(utils.ErrForbidden)
+		c.JSON(status, errResponse)
+		c.Abort()
+	}
+}
+
+// RequirePermission middleware checks if the user holds every given permission
+// through one of their roles, or the service account through its role. Only
+// the permissions within the scopes of the token count.
+func (m *AuthMiddleware) RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implementation for role-based access control
-		// Add this when you implement role management
+		if err := requireVerifiedEmail(c); err != nil {
+			status, errResponse := utils.GetErrorResponse(err)
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
+		granted, err := m.getPermissions(c)
+		if err != nil {
+			status, errResponse := utils.GetErrorResponse(err)
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if _, ok := granted[permission]; !ok {
+				if tokenMetadata, err := GetTokenMetadata(c); err == nil {
+					m.audit(c, model.AuditAccessDenied, tokenMetadata, map[string]interface{}{
+						"missing_permission": permission,
+					})
+				}
+				status, errResponse := utils.GetErrorResponse(utils.ErrForbidden)
+				c.JSON(status, errResponse)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope middleware checks that the access token or API key was granted
+// every given scope. Access tokens issued before scopes existed carry none and
+// are not limited.
+func (m *AuthMiddleware) RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenMetadata, err := GetTokenMetadata(c)
+		if err != nil {
+			status, errResponse := utils.GetErrorResponse(err)
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
+		if tokenMetadata.Scopes != nil {
+			for _, scope := range scopes {
+				if !hasScope(tokenMetadata.Scopes, scope) {
+					m.audit(c, model.AuditAccessDenied, tokenMetadata, map[string]interface{}{
+						"missing_scope": scope,
+					})
+					c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					status, errResponse := utils.GetErrorResponse(utils.ErrInsufficientScope)
+					c.JSON(status, errResponse)
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireFirstParty middleware refuses API keys and the access tokens of OAuth
+// clients on the routes that manage the sessions and credentials of the
+// account, so a leaked key or a client cannot be used to take the account over
+func (m *AuthMiddleware) RequireFirstParty() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenMetadata, err := GetTokenMetadata(c)
+		if reason := delegatedTokenReason(tokenMetadata); err == nil && reason != "" {
+			m.audit(c, model.AuditAccessDenied, tokenMetadata, map[string]interface{}{
+				"reason": reason,
+			})
+			status, errResponse := utils.GetErrorResponse(utils.ErrForbidden)
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
+// delegatedTokenReason tells whether the token is an API key or the access
+// token of an OAuth client, which act on behalf of the user with fewer rights
+func delegatedTokenReason(tokenMetadata *types.TokenMetadata) string {
+	switch {
+	case tokenMetadata == nil:
+		return ""
+	case tokenMetadata.ClientID != "":
+		return "oauth_client"
+	case tokenMetadata.APIKeyID != "":
+		return "api_key"
+	}
+	return ""
+}
+
+// audit records a refused request of the token's user or service account in the audit log
+func (m *AuthMiddleware) audit(c *gin.Context, eventType model.AuditEventType, tokenMetadata *types.TokenMetadata, details map[string]interface{}) {
+	details["method"] = c.Request.Method
+	details["path"] = c.FullPath()
+
+	entry := services.AuditEntry{
+		Type:    eventType,
+		Outcome: model.AuditFailure,
+		Client:  GetClientInfo(c),
+		Details: details,
+	}
+	if tokenMetadata.ServiceAccountID != "" {
+		details["service_account_id"] = tokenMetadata.ServiceAccountID
+	} else {
+		userID := tokenMetadata.UserID
+		entry.ActorID = &userID
+		entry.UserID = &userID
+	}
+	if tokenMetadata.APIKeyID != "" {
+		details["api_key_id"] = tokenMetadata.APIKeyID
+	}
+	if tokenMetadata.ClientID != "" {
+		details["client_id"] = tokenMetadata.ClientID
+	}
+	services.RecordAudit(m.auditor, entry)
+}
+
+// requireVerifiedEmail refuses the restricted access tokens issued to users
+// who did not verify their email address yet
+func requireVerifiedEmail(c *gin.Context) error {
+	metadata, err := GetTokenMetadata(c)
+	if err != nil {
+		return err
+	}
+	if !metadata.EmailVerified {
+		return utils.ErrEmailNotVerified
+	}
+	return nil
+}
+
+// getPermissions resolves the permissions of the authenticated user or
+// service account once per request, narrowed to the scopes of the token
+func (m *AuthMiddleware) getPermissions(c *gin.Context) (map[string]struct{}, error) {
+	if cached, exists := c.Get(string(PermissionsContextKey)); exists {
+		if permissions, ok := cached.(map[string]struct{}); ok {
+			return permissions, nil
+		}
+	}
+
+	var names []string
+	if serviceAccount, err := GetServiceAccount(c); err == nil {
+		names, err = m.rbacService.GetRolePermissions(serviceAccount.Role)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		authUser, err := GetAuthUser(c)
+		if err != nil {
+			return nil, err
+		}
+
+		names, err = m.rbacService.GetUserPermissions(authUser.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Access tokens and API keys only keep the permissions of their scopes
+	var scopes map[string]struct{}
+	if tokenMetadata, err := GetTokenMetadata(c); err == nil && tokenMetadata.Scopes != nil {
+		scopes = make(map[string]struct{}, len(tokenMetadata.Scopes))
+		for _, scope := range tokenMetadata.Scopes {
+			scopes[scope] = struct{}{}
+		}
+	}
+
+	permissions := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := scopes[name]; scopes != nil && !ok {
+			continue
+		}
+		permissions[name] = struct{}{}
+	}
+
+	c.Set(string(PermissionsContextKey), permissions)
+	return permissions, nil
+}
+
+func hasScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAuthUser helper function to get the authenticated user from context
 func GetAuthUser(c *gin.Context) (*AuthenticatedUser, error) {
 	user, exists := c.Get(string(UserContextKey))
@@ -77,6 +383,35 @@ func GetAuthUser(c *gin.Context) (*AuthenticatedUser, error) {
 	return &authUser, nil
 }
 
+// GetServiceAccount helper function to get the authenticated service account
+// from context. Requests of users have none.
+func GetServiceAccount(c *gin.Context) (*AuthenticatedServiceAccount, error) {
+	value, exists := c.Get(string(ServiceAccountContextKey))
+	if !exists {
+		return nil, utils.ErrUnauthorized
+	}
+
+	serviceAccount, ok := value.(AuthenticatedServiceAccount)
+	if !ok {
+		return nil, utils.ErrUnauthorized
+	}
+
+	return &serviceAccount, nil
+}
+
+// getPrincipalRole returns the role of the authenticated user or service account
+func getPrincipalRole(c *gin.Context) (string, error) {
+	if serviceAccount, err := GetServiceAccount(c); err == nil {
+		return serviceAccount.Role, nil
+	}
+
+	authUser, err := GetAuthUser(c)
+	if err != nil {
+		return "", err
+	}
+	return authUser.Role, nil
+}
+
 // GetTokenMetadata helper function to get the token metadata from context
 func GetTokenMetadata(c *gin.Context) (*types.TokenMetadata, error) {
 	metadata, exists := c.Get(string(TokenMetadataKey))
@@ -93,8 +428,32 @@ func GetTokenMetadata(c *gin.Context) (*types.TokenMetadata, error) {
 	return tokenMetadata, nil
 }
 
-// extractToken extracts the token from the Authorization header
+// maxUserAgentLength bounds the User-Agent header stored with sessions and audit events
+const maxUserAgentLength = 512
+
+// GetClientInfo describes the client of the request
+func GetClientInfo(c *gin.Context) types.ClientInfo {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+
+	return types.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent,
+	}
+}
+
+// extractToken extracts the access token or API key from the Authorization
+// header, or the API key from the X-API-Key header
 func extractToken(c *gin.Context) (string, error) {
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		if !services.IsAPIKey(apiKey) {
+			return "", utils.ErrInvalidAuthHeader
+		}
+		return apiKey, nil
+	}
+
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		return "", utils.ErrMissingAuthHeader
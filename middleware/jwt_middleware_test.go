@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/services"
+	"jwt-auth-app/types"
+)
+
+// recordingAuditor keeps the audited entries in memory
+type recordingAuditor struct {
+	entries []services.AuditEntry
+}
+
+func (a *recordingAuditor) Record(entry services.AuditEntry) error {
+	a.entries = append(a.entries, entry)
+	return nil
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		role     string
+		metadata types.TokenMetadata
+		status   int
+		reason   string
+	}{
+		{"admin session", "admin", types.TokenMetadata{Scopes: []string{"users:read"}}, http.StatusOK, ""},
+		{"super admin session", "super_admin", types.TokenMetadata{Scopes: []string{}}, http.StatusOK, ""},
+		{"token issued before scopes", "admin", types.TokenMetadata{}, http.StatusOK, ""},
+		{"user session", "user", types.TokenMetadata{Scopes: []string{"profile:read"}}, http.StatusForbidden, ""},
+		{"scoped API key of an admin", "admin", types.TokenMetadata{APIKeyID: "key", Scopes: []string{"profile:read"}}, http.StatusForbidden, "api_key"},
+		{"OAuth client token of an admin", "admin", types.TokenMetadata{ClientID: "client", Scopes: []string{"openid"}}, http.StatusForbidden, "oauth_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor := &recordingAuditor{}
+			m := &AuthMiddleware{auditor: auditor}
+
+			router := gin.New()
+			router.GET("/admin", func(c *gin.Context) {
+				metadata := tt.metadata
+				metadata.UserID = 1
+				metadata.EmailVerified = true
+				c.Set(string(TokenMetadataKey), &metadata)
+				c.Set(string(UserContextKey), AuthenticatedUser{ID: 1, Role: tt.role})
+			}, m.RequireRole("admin"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin", nil))
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status %d, want %d", recorder.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			if len(auditor.entries) != 1 {
+				t.Fatalf("%d refusals audited", len(auditor.entries))
+			}
+			if reason, _ := auditor.entries[0].Details["reason"].(string); reason != tt.reason {
+				t.Errorf("audited reason %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
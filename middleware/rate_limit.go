@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/ratelimit"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateLimitBodySize bounds how much of the body RateLimitByEmail reads
+const maxRateLimitBodySize = 64 << 10
+
+// RateLimitKey returns the identity a request is counted against
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitByIP counts requests per client IP
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByUser counts requests per authenticated user, it must run after
+// JWT(). Requests without a user are counted per client IP.
+func RateLimitByUser(c *gin.Context) string {
+	authUser, err := GetAuthUser(c)
+	if err != nil {
+		return RateLimitByIP(c)
+	}
+	return "user:" + strconv.FormatUint(uint64(authUser.ID), 10)
+}
+
+// RateLimitByEmail counts requests per email field of the JSON body. The body
+// is put back for the handler. Requests without an email are counted per client IP.
+func RateLimitByEmail(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRateLimitBodySize))
+	if err != nil {
+		return RateLimitByIP(c)
+	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Email == "" {
+		return RateLimitByIP(c)
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// RateLimit refuses requests beyond the rate of the limiter with RATE_LIMITED.
+// Every response carries the RateLimit-* headers, refused ones Retry-After as
+// well. When the store fails requests are let through.
+func RateLimit(limiter *ratelimit.Limiter, key RateLimitKey) gin.HandlerFunc {
+	rate := limiter.Rate()
+	if rate.Requests <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	policy := strconv.Itoa(rate.Requests) + ";w=" + strconv.FormatInt(int64(math.Ceil(rate.Window.Seconds())), 10)
+
+	return func(c *gin.Context) {
+		result, err := limiter.Allow(key(c), time.Now())
+		if err != nil {
+			log.Println("Rate limiter failed:", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+
+			status, errResponse := utils.GetErrorResponse(utils.ErrRateLimited)
+			errResponse.RetryAfter = retryAfter
+			c.JSON(status, errResponse)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds up to whole seconds, at least one
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Max(1, math.Ceil(d.Seconds())))
+}
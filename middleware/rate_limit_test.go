@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"jwt-auth-app/config"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils/ratelimit"
+)
+
+// newRateLimitedRouter answers POST /login with the email of the body, behind
+// a limit of two requests a minute
+func newRateLimitedRouter(store ratelimit.Store, key RateLimitKey) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	limiter := ratelimit.NewLimiter(store, "login", config.Rate{Requests: 2, Window: time.Minute})
+	router := gin.New()
+	router.POST("/login", RateLimit(limiter, key), func(c *gin.Context) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.String(http.StatusOK, req.Email)
+	})
+	return router
+}
+
+func postLogin(router *gin.Engine, ip, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`"}`))
+	req.RemoteAddr = ip + ":1234"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisStore, err := ratelimit.NewRedisStore(server.Addr(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]ratelimit.Store{"memory": ratelimit.NewMemoryStore(), "redis": redisStore} {
+		t.Run(name, func(t *testing.T) {
+			router := newRateLimitedRouter(store, RateLimitByIP)
+
+			for i, wantRemaining := range []string{"1", "0"} {
+				response := postLogin(router, "192.0.2.1", "user@example.com")
+				if response.Code != http.StatusOK {
+					t.Fatalf("request %d: status %d", i+1, response.Code)
+				}
+				if got := response.Header().Get("RateLimit-Policy"); got != "2;w=60" {
+					t.Errorf("request %d: RateLimit-Policy %q", i+1, got)
+				}
+				if got := response.Header().Get("RateLimit-Limit"); got != "2" {
+					t.Errorf("request %d: RateLimit-Limit %q", i+1, got)
+				}
+				if got := response.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+					t.Errorf("request %d: RateLimit-Remaining %q, want %q", i+1, got, wantRemaining)
+				}
+				if reset, err := strconv.Atoi(response.Header().Get("RateLimit-Reset")); err != nil || reset < 1 || reset > 60 {
+					t.Errorf("request %d: RateLimit-Reset %q", i+1, response.Header().Get("RateLimit-Reset"))
+				}
+				if got := response.Header().Get("Retry-After"); got != "" {
+					t.Errorf("request %d: Retry-After %q on an allowed request", i+1, got)
+				}
+			}
+
+			response := postLogin(router, "192.0.2.1", "user@example.com")
+			if response.Code != http.StatusTooManyRequests {
+				t.Fatalf("third request: status %d", response.Code)
+			}
+			retryAfter, err := strconv.ParseInt(response.Header().Get("Retry-After"), 10, 64)
+			if err != nil || retryAfter < 1 {
+				t.Errorf("Retry-After %q", response.Header().Get("Retry-After"))
+			}
+			if got := response.Header().Get("RateLimit-Remaining"); got != "0" {
+				t.Errorf("RateLimit-Remaining %q", got)
+			}
+
+			var errResponse types.ErrorResponse
+			if err := json.Unmarshal(response.Body.Bytes(), &errResponse); err != nil {
+				t.Fatal(err)
+			}
+			if errResponse.Code != "RATE_LIMITED" || errResponse.RetryAfter != retryAfter {
+				t.Errorf("body %s", response.Body)
+			}
+
+			// Another IP is not affected
+			if response := postLogin(router, "192.0.2.2", "user@example.com"); response.Code != http.StatusOK {
+				t.Errorf("request of another IP: status %d", response.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimitByEmail(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore(), RateLimitByEmail)
+
+	// Changing the IP does not help against the limit of an email address
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		response := postLogin(router, ip, "User@Example.com")
+		if response.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, response.Code)
+		}
+		// The handler still reads the body
+		if response.Body.String() != "User@Example.com" {
+			t.Errorf("request %d: handler read %q", i+1, response.Body)
+		}
+	}
+	if response := postLogin(router, "192.0.2.3", "user@example.com"); response.Code != http.StatusTooManyRequests {
+		t.Errorf("third request for the address: status %d", response.Code)
+	}
+	if response := postLogin(router, "192.0.2.3", "other@example.com"); response.Code != http.StatusOK {
+		t.Errorf("request for another address: status %d", response.Code)
+	}
+}
@@ -1,11 +1,13 @@
 package middleware
 
-// AuthenticatedUser represents the user data stored in gin context
-type AuthenticatedUser struct {
-	ID    uint   `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
-}
+import "jwt-auth-app/types"
+
+// AuthenticatedUser represents the user data stored in gin context. It is the
+// same type the users service produces so the value set by JWT() can be read back.
+type AuthenticatedUser = types.AuthenticatedUser
+
+// AuthenticatedServiceAccount represents the service account data stored in gin context
+type AuthenticatedServiceAccount = types.AuthenticatedServiceAccount
 
 // ContextKey type for context keys to avoid string collisions
 type ContextKey string
@@ -13,6 +15,10 @@ type ContextKey string
 const (
 	// UserContextKey is the key used to store the user in the context
 	UserContextKey ContextKey = "user"
+	// ServiceAccountContextKey is the key used to store the service account in the context
+	ServiceAccountContextKey ContextKey = "service_account"
 	// TokenMetadataKey is the key used to store token metadata in the context
 	TokenMetadataKey ContextKey = "token_metadata"
+	// PermissionsContextKey caches the resolved permissions of the user for the request
+	PermissionsContextKey ContextKey = "permissions"
 )
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+-- The built-in roles mirror the user_role enum, every user implicitly holds the one matching users.role
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Default role of every registered user'),
+    ('admin', 'Administrators'),
+    ('super_admin', 'Super administrators');
+
+INSERT INTO permissions (name, description) VALUES
+    ('profile:read', 'Read the own profile'),
+    ('profile:write', 'Update the own profile'),
+    ('users:read', 'Read any user'),
+    ('users:write', 'Manage any user'),
+    ('roles:read', 'Read roles and permissions'),
+    ('roles:write', 'Manage roles, permissions and role assignments');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE (r.name = 'user' AND p.name IN ('profile:read', 'profile:write'))
+   OR (r.name = 'admin' AND p.name IN ('profile:read', 'profile:write', 'users:read', 'users:write', 'roles:read'))
+   OR r.name = 'super_admin';
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_users_created_at ON users(created_at);
+CREATE INDEX idx_users_search ON users USING GIN (to_tsvector('simple', name || ' ' || email));
@@ -0,0 +1,5 @@
+ALTER TABLE refresh_token_families
+    DROP COLUMN user_agent,
+    DROP COLUMN ip_address,
+    DROP COLUMN device_name,
+    DROP COLUMN last_used_at;
\ No newline at end of file
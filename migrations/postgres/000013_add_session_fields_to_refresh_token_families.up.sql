@@ -0,0 +1,12 @@
+ALTER TABLE refresh_token_families
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN device_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE;
+
+-- Sessions started before they were tracked were last seen when they started
+UPDATE refresh_token_families SET last_used_at = created_at;
+
+ALTER TABLE refresh_token_families
+    ALTER COLUMN last_used_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN last_used_at SET NOT NULL;
@@ -0,0 +1,51 @@
+-- Events outlive the users they mention, so there are no foreign keys
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    actor_id INTEGER,
+    user_id INTEGER,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_audit_events_type ON audit_events(type);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_user_id ON audit_events(user_id);
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_modify
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- The single row locked by every append
+CREATE TABLE IF NOT EXISTS audit_chain_heads (
+    id INTEGER PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    last_hash VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+INSERT INTO audit_chain_heads (id) VALUES (1);
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'Read and export the audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name IN ('admin', 'super_admin') AND p.name = 'audit:read'
+ON CONFLICT DO NOTHING;
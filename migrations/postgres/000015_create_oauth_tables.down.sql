@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE name IN ('oauth_clients:read', 'oauth_clients:write');
+
+DROP INDEX IF EXISTS idx_refresh_token_families_client_id;
+ALTER TABLE refresh_token_families DROP COLUMN client_id;
+
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
\ No newline at end of file
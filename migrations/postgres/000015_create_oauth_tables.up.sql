@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL DEFAULT '',
+    redirect_uris TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    code_challenge VARCHAR(128) NOT NULL,
+    family_id VARCHAR(64) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_authorization_codes_client_id ON oauth_authorization_codes(client_id);
+CREATE INDEX idx_oauth_authorization_codes_user_id ON oauth_authorization_codes(user_id);
+CREATE INDEX idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- Sessions started through an OAuth client can only be refreshed by it, the
+-- sessions of this API's own login have no client
+ALTER TABLE refresh_token_families
+    ADD COLUMN client_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_refresh_token_families_client_id ON refresh_token_families(client_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('oauth_clients:read', 'List and view OAuth clients'),
+    ('oauth_clients:write', 'Register, update and delete OAuth clients')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name IN ('admin', 'super_admin') AND p.name IN ('oauth_clients:read', 'oauth_clients:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,12 @@
+ALTER TABLE oauth_consents DROP COLUMN scope;
+
+ALTER TABLE oauth_authorization_codes
+    DROP COLUMN scope,
+    DROP COLUMN nonce,
+    DROP COLUMN auth_methods,
+    DROP COLUMN auth_time;
+
+ALTER TABLE refresh_token_families
+    DROP COLUMN scope,
+    DROP COLUMN auth_methods,
+    DROP COLUMN auth_time;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- Sessions remember how and when the user authenticated, and the scope
+-- granted to the OAuth client that started them
+ALTER TABLE refresh_token_families
+    ADD COLUMN scope VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN auth_methods VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE;
+
+-- Sessions started before were authenticated when they started
+UPDATE refresh_token_families SET auth_time = created_at;
+
+ALTER TABLE refresh_token_families
+    ALTER COLUMN auth_time SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN auth_time SET NOT NULL;
+
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN scope VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN nonce VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN auth_methods VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE;
+
+UPDATE oauth_authorization_codes SET auth_time = created_at;
+
+ALTER TABLE oauth_authorization_codes
+    ALTER COLUMN auth_time SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN auth_time SET NOT NULL;
+
+ALTER TABLE oauth_consents
+    ADD COLUMN scope VARCHAR(255) NOT NULL DEFAULT '';
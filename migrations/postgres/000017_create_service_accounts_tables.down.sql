@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE name IN ('service_accounts:read', 'service_accounts:write');
+
+DROP TABLE IF EXISTS client_assertions;
+DROP TABLE IF EXISTS service_accounts;
\ No newline at end of file
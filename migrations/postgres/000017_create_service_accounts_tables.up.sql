@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    role VARCHAR(100) NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL DEFAULT '',
+    public_key TEXT NOT NULL DEFAULT '',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS client_assertions (
+    jti_hash VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_client_assertions_expires_at ON client_assertions(expires_at);
+
+-- A service account holds the permissions of any role, so only super admins
+-- may manage them
+INSERT INTO permissions (name, description) VALUES
+    ('service_accounts:read', 'List and view service accounts'),
+    ('service_accounts:write', 'Create, update and delete service accounts')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'super_admin' AND p.name IN ('service_accounts:read', 'service_accounts:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// APIKey is a long-lived credential a user creates for CLI tools and CI
+// pipelines. It acts as the user, limited to the permissions of its scopes.
+type APIKey struct {
+	ID     string `gorm:"primarykey"`
+	UserID uint   `gorm:"not null;index"`
+	Name   string `gorm:"not null"`
+	// Prefix is the start of the key, shown so the user can recognize it
+	Prefix string `gorm:"not null"`
+	// KeyHash is the SHA-256 hash of the key
+	KeyHash string `gorm:"uniqueIndex;not null"`
+	// Scopes is the space separated list of permissions the key is limited to
+	Scopes     string `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// IsExpired reports whether the key expired
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+}
@@ -0,0 +1,90 @@
+package model
+
+import "time"
+
+// AuditEventType names a security relevant event
+type AuditEventType string
+
+const (
+	AuditUserRegistered           AuditEventType = "user.registered"
+	AuditLoginSucceeded           AuditEventType = "auth.login.succeeded"
+	AuditLoginFailed              AuditEventType = "auth.login.failed"
+	AuditMFAFailed                AuditEventType = "auth.mfa.failed"
+	AuditTokenRefreshed           AuditEventType = "auth.token.refreshed"
+	AuditRefreshTokenReused       AuditEventType = "auth.token.reused"
+	AuditTokenRejected            AuditEventType = "auth.token.rejected"
+	AuditAccessDenied             AuditEventType = "auth.access.denied"
+	AuditLogout                   AuditEventType = "auth.logout"
+	AuditLogoutAll                AuditEventType = "auth.logout_all"
+	AuditSessionRevoked           AuditEventType = "auth.session.revoked"
+	AuditOAuthAuthorized          AuditEventType = "oauth.authorization.granted"
+	AuditOAuthDenied              AuditEventType = "oauth.authorization.denied"
+	AuditOAuthCodeReused          AuditEventType = "oauth.code.reused"
+	AuditServiceTokenIssued       AuditEventType = "service_account.token.issued"
+	AuditServiceAuthFailed        AuditEventType = "service_account.authentication.failed"
+	AuditEmailVerified            AuditEventType = "user.email.verified"
+	AuditEmailChangeRequested     AuditEventType = "user.email.change_requested"
+	AuditEmailChanged             AuditEventType = "user.email.changed"
+	AuditPasswordChanged          AuditEventType = "user.password.changed"
+	AuditPasswordResetRequested   AuditEventType = "user.password.reset_requested"
+	AuditPasswordReset            AuditEventType = "user.password.reset"
+	AuditMFAEnabled               AuditEventType = "user.mfa.enabled"
+	AuditMFADisabled              AuditEventType = "user.mfa.disabled"
+	AuditRecoveryCodesRegenerated AuditEventType = "user.mfa.recovery_codes_regenerated"
+	AuditPasskeyRegistered        AuditEventType = "user.passkey.registered"
+	AuditPasskeyDeleted           AuditEventType = "user.passkey.deleted"
+	AuditAPIKeyCreated            AuditEventType = "user.api_key.created"
+	AuditAPIKeyUpdated            AuditEventType = "user.api_key.updated"
+	AuditAPIKeyDeleted            AuditEventType = "user.api_key.deleted"
+	AuditProfileUpdated           AuditEventType = "user.profile.updated"
+	AuditAccountDeleted           AuditEventType = "user.deleted"
+	AuditAdminRoleChanged         AuditEventType = "admin.user.role_changed"
+	AuditAdminStatusChanged       AuditEventType = "admin.user.status_changed"
+	AuditAdminPasswordResetForced AuditEventType = "admin.user.password_reset_forced"
+	AuditAdminUserUnlocked        AuditEventType = "admin.user.unlocked"
+	AuditAdminUserDeleted         AuditEventType = "admin.user.deleted"
+	AuditAdminOAuthClientCreated  AuditEventType = "admin.oauth_client.created"
+	AuditAdminOAuthClientUpdated  AuditEventType = "admin.oauth_client.updated"
+	AuditAdminOAuthClientDeleted  AuditEventType = "admin.oauth_client.deleted"
+	AuditAdminOAuthSecretRotated  AuditEventType = "admin.oauth_client.secret_rotated"
+	AuditAdminServiceCreated      AuditEventType = "admin.service_account.created"
+	AuditAdminServiceUpdated      AuditEventType = "admin.service_account.updated"
+	AuditAdminServiceDeleted      AuditEventType = "admin.service_account.deleted"
+	AuditAdminServiceSecretReset  AuditEventType = "admin.service_account.secret_rotated"
+)
+
+// AuditOutcome tells whether the audited action succeeded
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEvent is an entry of the append-only audit log. Every event is chained
+// to the previous one by its hash, so changed or removed events are detected.
+type AuditEvent struct {
+	// ID is assigned in sequence without gaps while the chain is locked
+	ID      uint64         `gorm:"primarykey;autoIncrement:false"`
+	Type    AuditEventType `gorm:"not null;index"`
+	Outcome AuditOutcome   `gorm:"not null"`
+	// ActorID is the user who performed the action, UserID the user it concerns
+	ActorID   *uint  `gorm:"index"`
+	UserID    *uint  `gorm:"index"`
+	IPAddress string `gorm:"not null;default:''"`
+	UserAgent string `gorm:"not null;default:''"`
+	// Details is a JSON object, kept as text so the hashed bytes are stored unchanged
+	Details   string    `gorm:"not null;default:'{}'"`
+	CreatedAt time.Time `gorm:"not null;index"`
+	PrevHash  string    `gorm:"not null;default:''"`
+	Hash      string    `gorm:"not null"`
+}
+
+// AuditChainHead points at the last event of the audit log. Locking it
+// serializes appends, and comparing it with the last event detects events
+// removed from the end of the log.
+type AuditChainHead struct {
+	ID          uint   `gorm:"primarykey"`
+	LastEventID uint64 `gorm:"not null;default:0"`
+	LastHash    string `gorm:"not null;default:''"`
+}
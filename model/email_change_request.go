@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// EmailChangeRequest is a pending change of the email address of a user. The
+// address is only swapped once the single-use token emailed to NewEmail is
+// confirmed. Only the SHA-256 hash of the token is stored.
+type EmailChangeRequest struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"not null;index"`
+	NewEmail  string    `gorm:"not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
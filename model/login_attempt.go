@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// LoginAttempt counts the failed logins of an account or a client IP
+type LoginAttempt struct {
+	Key string `gorm:"primarykey"`
+	// Failures is the number of failed attempts since WindowStart
+	Failures    int       `gorm:"not null;default:0"`
+	WindowStart time.Time `gorm:"not null"`
+	// Lockouts is the number of consecutive lockouts, each one lasts twice as long
+	Lockouts    int `gorm:"not null;default:0"`
+	LockedUntil *time.Time
+	UpdatedAt   time.Time `gorm:"index"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// UserTOTP is the TOTP secret of a user. Two-factor authentication is only
+// enabled once the enrollment was confirmed with a valid code.
+type UserTOTP struct {
+	UserID uint   `gorm:"primarykey;autoIncrement:false"`
+	Secret string `gorm:"not null"`
+	// LastUsedStep is the last time step a code was accepted for, so codes cannot be replayed
+	LastUsedStep int64 `gorm:"not null;default:0"`
+	ConfirmedAt  *time.Time
+	CreatedAt    time.Time
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// IsEnabled reports whether the enrollment was confirmed
+func (t *UserTOTP) IsEnabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// MFARecoveryCode is a one-time code that replaces a TOTP code, e.g. when the
+// device was lost. Only the SHA-256 hash of the code is stored.
+type MFARecoveryCode struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClientType tells whether an OAuth client can keep a secret
+type OAuthClientType string
+
+const (
+	// OAuthClientPublic clients such as SPAs and mobile apps cannot keep a
+	// secret, they are only authenticated by PKCE
+	OAuthClientPublic OAuthClientType = "public"
+	// OAuthClientConfidential clients run on a server and authenticate with their secret
+	OAuthClientConfidential OAuthClientType = "confidential"
+)
+
+// OAuthClient is an application registered to obtain tokens on behalf of users
+type OAuthClient struct {
+	// ID is the client_id of the OAuth requests
+	ID   string          `gorm:"primarykey"`
+	Name string          `gorm:"not null"`
+	Type OAuthClientType `gorm:"not null"`
+	// SecretHash is the SHA-256 hash of the secret of confidential clients
+	SecretHash string `gorm:"not null;default:''"`
+	// RedirectURIs is the space separated list of registered redirect URIs,
+	// which cannot contain spaces themselves
+	RedirectURIs string `gorm:"not null;default:''"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RedirectURIList returns the registered redirect URIs
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// HasRedirectURI reports whether the redirect URI is registered, URIs are
+// compared as exact strings
+func (c *OAuthClient) HasRedirectURI(redirectURI string) bool {
+	for _, registered := range c.RedirectURIList() {
+		if registered == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthAuthorizationCode is a short-lived code issued once the user approved
+// a client. It is exchanged once for a token pair. Only the SHA-256 hash of
+// the code is stored.
+type OAuthAuthorizationCode struct {
+	CodeHash    string `gorm:"primarykey"`
+	ClientID    string `gorm:"not null;index"`
+	UserID      uint   `gorm:"not null;index"`
+	RedirectURI string `gorm:"not null"`
+	// CodeChallenge is the PKCE S256 challenge the code verifier must match
+	CodeChallenge string `gorm:"not null"`
+	// Scope is the space separated scope the user approved
+	Scope string `gorm:"not null;default:''"`
+	// Nonce is returned in the ID token to bind it to the authorization request
+	Nonce string `gorm:"not null;default:''"`
+	// AuthMethods and AuthTime describe the authentication of the session
+	// that approved the client, they are carried over to the new session
+	AuthMethods string    `gorm:"not null;default:''"`
+	AuthTime    time.Time `gorm:"not null"`
+	// FamilyID is the session started by the exchange, revoked if the code is presented again
+	FamilyID   string    `gorm:"not null;default:''"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// OAuthConsent remembers that a user allowed a client to act on their behalf
+type OAuthConsent struct {
+	UserID    uint   `gorm:"primarykey;autoIncrement:false"`
+	ClientID  string `gorm:"primarykey"`
+	CreatedAt time.Time
+	// Scope is the space separated union of the scopes the user approved
+	Scope string `gorm:"not null;default:''"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Role is a named set of permissions that can be assigned to users. The
+// built-in roles share their names with UserRole.
+type Role struct {
+	ID          uint         `gorm:"primarykey" json:"id"`
+	Name        string       `gorm:"uniqueIndex;not null" json:"name"`
+	Description string       `gorm:"not null;default:''" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// IsBuiltIn reports whether the role mirrors one of the UserRole values
+func (r *Role) IsBuiltIn() bool {
+	return UserRole(r.Name).IsValid()
+}
+
+// Permission grants a single action, named "resource:action"
+type Permission struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"not null;default:''" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UserRoleAssignment assigns an additional role to a user
+type UserRoleAssignment struct {
+	UserID    uint      `gorm:"primarykey;autoIncrement:false"`
+	RoleID    uint      `gorm:"primarykey;autoIncrement:false"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (UserRoleAssignment) TableName() string {
+	return "user_roles"
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// RefreshTokenFamily groups every refresh token that descends from a single
+// login. It is the session of the user on one device.
+type RefreshTokenFamily struct {
+	ID     string `gorm:"primarykey"`
+	UserID uint   `gorm:"not null;index"`
+	// UserAgent, IPAddress and DeviceName describe the client that last used the session
+	UserAgent  string `gorm:"not null;default:''"`
+	IPAddress  string `gorm:"not null;default:''"`
+	DeviceName string `gorm:"not null;default:''"`
+	// ClientID is the OAuth client the session was started by, empty for this API's own login
+	ClientID   string     `gorm:"not null;default:'';index"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Scope is the space separated scope granted to the OAuth client
+	Scope string `gorm:"not null;default:''"`
+	// AuthMethods is the space separated list of RFC 8176 methods the user
+	// authenticated with when the session started at AuthTime
+	AuthMethods string    `gorm:"not null;default:''"`
+	AuthTime    time.Time `gorm:"not null"`
+}
+
+// RefreshToken is a single issued refresh token, consumed when it is exchanged
+type RefreshToken struct {
+	JTI        string    `gorm:"column:jti;primarykey"`
+	FamilyID   string    `gorm:"not null;index"`
+	UserID     uint      `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// RevokedToken is a single access or refresh token that was revoked before it expired
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;primarykey"`
+	UserID    uint      `gorm:"not null"`
+	TokenType string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	RevokedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// UserTokenRevocation invalidates every token of a user issued before RevokedBefore
+type UserTokenRevocation struct {
+	UserID        uint      `gorm:"primarykey;autoIncrement:false"`
+	RevokedBefore time.Time `gorm:"not null"`
+}
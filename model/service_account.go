@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// ServiceAccount is a non-human principal, such as a backend job, that
+// obtains access tokens with the client credentials grant. It authenticates
+// either with a secret or with client assertions signed by its private key.
+type ServiceAccount struct {
+	// ID is the client_id of the token requests
+	ID   string `gorm:"primarykey"`
+	Name string `gorm:"not null"`
+	// Role names the role whose permissions the service account holds
+	Role string `gorm:"not null"`
+	// SecretHash is the SHA-256 hash of the secret, empty when the account
+	// authenticates with a key
+	SecretHash string `gorm:"not null;default:''"`
+	// PublicKey is the PEM encoded key that verifies the client assertions of
+	// private_key_jwt, empty when the account authenticates with a secret
+	PublicKey  string `gorm:"not null;default:''"`
+	IsActive   bool   `gorm:"not null;default:true"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// UsesKey reports whether the service account authenticates with private_key_jwt
+func (a *ServiceAccount) UsesKey() bool {
+	return a.PublicKey != ""
+}
+
+// ClientAssertion records a client assertion that was used, until it expires,
+// so it cannot be presented again
+type ClientAssertion struct {
+	// JTIHash is the SHA-256 hash of the service account ID and the jti of the assertion
+	JTIHash   string    `gorm:"primarykey"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
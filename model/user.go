@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type UserRole string
 
@@ -10,14 +13,40 @@ const (
 	RoleSuperAdmin UserRole = "super_admin"
 )
 
+// roleLevels orders the roles so that every role includes the ones below it
+var roleLevels = map[UserRole]int{
+	RoleUser:       1,
+	RoleAdmin:      2,
+	RoleSuperAdmin: 3,
+}
+
+// IsValid reports whether the role is one of the known roles
+func (r UserRole) IsValid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Includes reports whether the role grants at least the access of the required
+// role (super_admin ⊇ admin ⊇ user)
+func (r UserRole) Includes(required UserRole) bool {
+	return r.IsValid() && required.IsValid() && roleLevels[r] >= roleLevels[required]
+}
+
 type User struct {
-	ID        uint       `gorm:"primarykey"`
-	Name      string     `json:"name" gorm:"not null"`
-	Email     string     `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string     `json:"-" gorm:"not null"`
-	Role      UserRole   `json:"role" gorm:"type:user_role;default:'user'"`
-	IsActive  bool       `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+	ID                    uint           `gorm:"primarykey"`
+	Name                  string         `json:"name" gorm:"not null"`
+	Email                 string         `json:"email" gorm:"uniqueIndex;not null"`
+	Password              string         `json:"-" gorm:"not null"`
+	Role                  UserRole       `json:"role" gorm:"type:user_role;default:'user'"`
+	IsActive              bool           `json:"is_active" gorm:"default:true"`
+	PasswordResetRequired bool           `json:"password_reset_required" gorm:"not null;default:false"`
+	EmailVerifiedAt       *time.Time     `json:"email_verified_at,omitempty"`
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// IsEmailVerified reports whether the user proved ownership of their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
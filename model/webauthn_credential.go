@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID              uint   `gorm:"primarykey" json:"id"`
+	UserID          uint   `gorm:"not null;index" json:"-"`
+	Name            string `gorm:"not null;default:''" json:"name"`
+	CredentialID    []byte `gorm:"uniqueIndex;not null" json:"-"`
+	PublicKey       []byte `gorm:"not null" json:"-"`
+	AttestationType string `gorm:"not null;default:''" json:"-"`
+	// Transports is the comma separated list of transports reported by the authenticator
+	Transports string `gorm:"not null;default:''" json:"-"`
+	AAGUID     []byte `gorm:"column:aaguid" json:"-"`
+	// SignCount is the last signature counter seen, a counter that does not
+	// increase indicates a cloned authenticator
+	SignCount      uint32     `gorm:"not null;default:0" json:"-"`
+	BackupEligible bool       `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState    bool       `gorm:"not null;default:false" json:"backup_state"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnSession keeps the challenge of a registration or login ceremony
+// between its begin and finish requests
+type WebAuthnSession struct {
+	ID        string `gorm:"primarykey"`
+	Ceremony  string `gorm:"not null"`
+	UserID    *uint
+	Data      []byte    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/mailer"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChangePassword sets a new password after checking the current one. Every
+// other session is revoked and the caller gets a new token pair.
+func (s *AuthService) ChangePassword(userID uint, req *types.ChangePasswordRequest, client types.ClientInfo) (*types.TokenPair, error) {
+	user, err := s.reauthenticate(userID, req.CurrentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.passwordPolicy.Validate("new_password", req.NewPassword, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwords.Hash(req.NewPassword)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":                hashedPassword,
+			"password_reset_required": false,
+		}).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+
+		// Links sent before the change must not be able to undo it
+		return s.invalidateResetTokens(tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.restartSessions(user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(model.AuditPasswordChanged, model.AuditSuccess, user.ID, client, map[string]interface{}{
+		"session_id": tokens.RefreshTokenMetadata.FamilyID,
+	})
+	return tokens, nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address and a
+// notice to the current one. The address only changes once the link is confirmed.
+func (s *AuthService) RequestEmailChange(userID uint, req *types.ChangeEmailRequest) error {
+	user, err := s.reauthenticate(userID, req.Password)
+	if err != nil {
+		return err
+	}
+
+	newEmail := strings.TrimSpace(req.NewEmail)
+	if err := s.checkEmailAvailable(s.db, newEmail); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return utils.ErrInternalServer
+	}
+
+	expiration := config.AppConfig.EmailVerification.Expiration
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Only the most recent request stays valid
+		if err := s.invalidateEmailChanges(tx, user.ID); err != nil {
+			return err
+		}
+
+		return tx.Create(&model.EmailChangeRequest{
+			UserID:    user.ID,
+			NewEmail:  newEmail,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(expiration),
+		}).Error
+	})
+	if err != nil {
+		return utils.ErrInternalServer
+	}
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", config.AppConfig.Server.FrontendURL, url.QueryEscape(token))
+	if err := s.mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm that you want to use this address for your account with the link below. "+
+			"It expires in %s.\n\n%s\n\nIf you did not ask for this change, you can ignore this email.\n", user.Name, expiration, link),
+	}); err != nil {
+		log.Println("Failed to send email change confirmation:", err)
+		return utils.ErrInternalServer
+	}
+
+	// The notice only informs, the change can still be confirmed if it fails
+	if err := s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nA change of the email address of your account to %s was requested. "+
+			"It takes effect once confirmed from the new address.\n\n"+
+			"If you did not ask for this change, reset your password right away.\n", user.Name, newEmail),
+	}); err != nil {
+		log.Println("Failed to send email change notice:", err)
+	}
+
+	s.audit(model.AuditEmailChangeRequested, model.AuditSuccess, user.ID, types.ClientInfo{}, map[string]interface{}{
+		"new_email": newEmail,
+	})
+	return nil
+}
+
+// ConfirmEmailChange swaps the email address of the user for the one the token
+// was sent to, which also verifies it. The token can only be used once.
+func (s *AuthService) ConfirmEmailChange(token string) error {
+	var request model.EmailChangeRequest
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrInvalidEmailChange
+		}
+		return utils.ErrInternalServer
+	}
+
+	if request.UsedAt != nil || time.Now().After(request.ExpiresAt) {
+		return utils.ErrInvalidEmailChange
+	}
+
+	var user model.User
+	if err := s.db.First(&user, request.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrInvalidEmailChange
+		}
+		return utils.ErrInternalServer
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Consuming with a conditional update keeps concurrent confirmations from both succeeding
+		result := tx.Model(&model.EmailChangeRequest{}).
+			Where("id = ? AND used_at IS NULL", request.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return utils.ErrInternalServer
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrInvalidEmailChange
+		}
+
+		// The address may have been registered since the request, the unique
+		// index would refuse it anyway
+		if err := s.checkEmailAvailable(tx, request.NewEmail); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"email":             request.NewEmail,
+			"email_verified_at": time.Now(),
+		}).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+
+		// Reset links went to the previous address
+		return s.invalidateResetTokens(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.audit(model.AuditEmailChanged, model.AuditSuccess, user.ID, types.ClientInfo{}, map[string]interface{}{
+		"old_email": user.Email,
+		"new_email": request.NewEmail,
+	})
+	return nil
+}
+
+// reauthenticate loads the user and checks their password before a sensitive
+// change. Wrong passwords count against the account like failed logins.
+func (s *AuthService) reauthenticate(userID uint, password string) (*model.User, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	now := time.Now()
+	if err := s.checkLoginLocked(now, accountAttemptKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	match, _, err := s.passwords.Verify(password, user.Password)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	if !match {
+		err := s.recordLoginFailure(utils.ErrInvalidCredentials, user.Email, "", now)
+		s.audit(model.AuditLoginFailed, model.AuditFailure, user.ID, types.ClientInfo{}, map[string]interface{}{
+			"method": "reauthentication",
+			"reason": auditReason(err),
+		})
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// checkEmailAvailable refuses addresses used by any account. Deleted accounts
+// keep their address, so they are included.
+func (s *AuthService) checkEmailAvailable(db *gorm.DB, email string) error {
+	var count int64
+	if err := db.Unscoped().Model(&model.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	if count > 0 {
+		return utils.ErrUserExists
+	}
+	return nil
+}
+
+// invalidateEmailChanges marks every pending email change of the user as used
+func (s *AuthService) invalidateEmailChanges(db *gorm.DB, userID uint) error {
+	if err := db.Model(&model.EmailChangeRequest{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
+
+// restartSessions revokes every token of the user and starts a new session
+// for the caller
+func (s *AuthService) restartSessions(user *model.User, client types.ClientInfo) (*types.TokenPair, error) {
+	if err := revokeUserTokens(s.db, s.revocations, user.ID); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, client, authMethodPassword)
+}
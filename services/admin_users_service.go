@@ -0,0 +1,270 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"gorm.io/gorm"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultUserPageSize = 20
+	// userSearchVector must match the expression of idx_users_search
+	userSearchVector = "to_tsvector('simple', name || ' ' || email)"
+)
+
+// ListUsers returns one page of users, newest first. The cursor is the opaque
+// next_cursor of the previous page.
+func (s *UsersService) ListUsers(query *types.ListUsersQuery) (*types.UserListResponse, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultUserPageSize
+	}
+
+	db := s.DB.Model(&model.User{})
+	if query.IncludeDeleted {
+		db = db.Unscoped()
+	}
+
+	if query.Cursor != "" {
+		lastID, err := decodeIDCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("id < ?", lastID)
+	}
+	if query.Role != "" {
+		db = db.Where("role = ?", query.Role)
+	}
+	if query.IsActive != nil {
+		db = db.Where("is_active = ?", *query.IsActive)
+	}
+	if query.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *query.CreatedAfter)
+	}
+	if query.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *query.CreatedBefore)
+	}
+	if tsQuery := buildPrefixTSQuery(query.Search); tsQuery != "" {
+		db = db.Where(userSearchVector+" @@ to_tsquery('simple', ?)", tsQuery)
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	var users []model.User
+	if err := db.Order("id DESC").Limit(limit + 1).Find(&users).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	response := &types.UserListResponse{Users: make([]types.UserResponse, 0, limit)}
+	if len(users) > limit {
+		users = users[:limit]
+		response.NextCursor = encodeIDCursor(uint64(users[limit-1].ID))
+	}
+	for i := range users {
+		response.Users = append(response.Users, ToUserResponse(&users[i]))
+	}
+
+	return response, nil
+}
+
+// GetUserForAdmin retrieves a user by ID, including deleted ones
+func (s *UsersService) GetUserForAdmin(userID uint) (*model.User, error) {
+	var user model.User
+	if err := s.DB.Unscoped().First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &user, nil
+}
+
+// ChangeRole sets the role of a user. Admins can only manage users and roles
+// up to their own role.
+func (s *UsersService) ChangeRole(actor *types.AuthenticatedUser, userID uint, role model.UserRole) (*types.UserResponse, error) {
+	user, err := s.getManageableUser(actor, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !model.UserRole(actor.Role).Includes(role) {
+		return nil, utils.ErrForbidden
+	}
+
+	previousRole := user.Role
+	if err := s.DB.Model(user).Update("role", role).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminRoleChanged, actor.ID, user.ID, map[string]interface{}{
+		"previous_role": previousRole,
+		"role":          role,
+	})
+
+	response := ToUserResponse(user)
+	return &response, nil
+}
+
+// SetActive activates or deactivates a user. Deactivation revokes all sessions.
+func (s *UsersService) SetActive(actor *types.AuthenticatedUser, userID uint, active bool) (*types.UserResponse, error) {
+	user, err := s.getManageableUser(actor, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(user).Update("is_active", active).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	if !active {
+		if err := revokeUserTokens(s.DB, s.Revocations, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.audit(model.AuditAdminStatusChanged, actor.ID, user.ID, map[string]interface{}{
+		"is_active": active,
+	})
+
+	response := ToUserResponse(user)
+	return &response, nil
+}
+
+// ForcePasswordReset signs the user out everywhere and blocks login until the
+// password was reset
+func (s *UsersService) ForcePasswordReset(actor *types.AuthenticatedUser, userID uint) (*types.UserResponse, error) {
+	user, err := s.getManageableUser(actor, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(user).Update("password_reset_required", true).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	if err := revokeUserTokens(s.DB, s.Revocations, user.ID); err != nil {
+		return nil, err
+	}
+
+	s.audit(model.AuditAdminPasswordResetForced, actor.ID, user.ID, nil)
+
+	response := ToUserResponse(user)
+	return &response, nil
+}
+
+// UnlockUser lifts the lockout of an account and forgets its failed logins
+func (s *UsersService) UnlockUser(actor *types.AuthenticatedUser, userID uint) (*types.UserResponse, error) {
+	user, err := s.getManageableUser(actor, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.LoginAttempts.Reset(accountAttemptKey(user.Email)); err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminUserUnlocked, actor.ID, user.ID, nil)
+
+	response := ToUserResponse(user)
+	return &response, nil
+}
+
+// DeleteUser soft-deletes a user, or removes it with all its data when hard is set
+func (s *UsersService) DeleteUser(actor *types.AuthenticatedUser, userID uint, hard bool) error {
+	user, err := s.getManageableUser(actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if hard {
+		if err := s.DB.Unscoped().Delete(user).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+		s.audit(model.AuditAdminUserDeleted, actor.ID, user.ID, map[string]interface{}{
+			"email": user.Email,
+			"hard":  true,
+		})
+		return nil
+	}
+
+	if user.DeletedAt.Valid {
+		return nil
+	}
+
+	if err := s.DB.Delete(user).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+
+	if err := revokeUserTokens(s.DB, s.Revocations, user.ID); err != nil {
+		return err
+	}
+
+	s.audit(model.AuditAdminUserDeleted, actor.ID, user.ID, map[string]interface{}{
+		"email": user.Email,
+		"hard":  false,
+	})
+	return nil
+}
+
+// getManageableUser loads a user the actor is allowed to manage: admins cannot
+// manage themselves or anyone holding a higher role
+func (s *UsersService) getManageableUser(actor *types.AuthenticatedUser, userID uint) (*model.User, error) {
+	if actor.ID == userID {
+		return nil, utils.ErrForbidden
+	}
+
+	user, err := s.GetUserForAdmin(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !model.UserRole(actor.Role).Includes(user.Role) {
+		return nil, utils.ErrForbidden
+	}
+
+	return user, nil
+}
+
+// encodeIDCursor encodes the id of the last row of a page as an opaque cursor
+func encodeIDCursor(id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(id, 10)))
+}
+
+func decodeIDCursor(cursor string) (uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, utils.ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, utils.ErrInvalidCursor
+	}
+
+	return id, nil
+}
+
+// buildPrefixTSQuery turns free text into a tsquery matching every word as a
+// prefix, e.g. "jo exam" becomes 'jo':* & 'exam':*. Characters with a meaning
+// in tsquery syntax are dropped.
+func buildPrefixTSQuery(search string) string {
+	var terms []string
+	for _, word := range strings.Fields(search) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("@.-_+", r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+
+		if word != "" {
+			terms = append(terms, "'"+word+"':*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
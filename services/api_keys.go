@@ -0,0 +1,270 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so keys are told apart from access
+// tokens and can be found by secret scanners
+const APIKeyPrefix = "ak_"
+
+// apiKeyPrefixLength is how much of a key is kept for its user to recognize it
+const apiKeyPrefixLength = len(APIKeyPrefix) + 8
+
+// apiKeyLastUsedInterval bounds how often last_used_at is written, a key used
+// by every request of a pipeline would otherwise write on each of them
+const apiKeyLastUsedInterval = time.Minute
+
+// APIKeyService manages the API keys of users and authenticates the requests
+// made with them
+type APIKeyService struct {
+	DB      *gorm.DB
+	RBAC    *RBACService
+	Auditor Auditor
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{
+		DB:      config.DB,
+		RBAC:    NewRBACService(),
+		Auditor: NewAuditor(),
+	}
+}
+
+// IsAPIKey reports whether a credential is an API key rather than an access token
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// ToAPIKeyResponse converts a model.APIKey to its representation in the API
+func ToAPIKeyResponse(apiKey *model.APIKey) types.APIKeyResponse {
+	return types.APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     strings.Fields(apiKey.Scopes),
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+// ListAPIKeys returns the API keys of the user, expired ones included
+func (s *APIKeyService) ListAPIKeys(userID uint) ([]types.APIKeyResponse, error) {
+	var apiKeys []model.APIKey
+	if err := s.DB.Where("user_id = ?", userID).Order("created_at").Find(&apiKeys).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	responses := make([]types.APIKeyResponse, 0, len(apiKeys))
+	for i := range apiKeys {
+		responses = append(responses, ToAPIKeyResponse(&apiKeys[i]))
+	}
+	return responses, nil
+}
+
+func (s *APIKeyService) GetAPIKey(userID uint, apiKeyID string) (*types.APIKeyResponse, error) {
+	apiKey, err := s.findAPIKey(userID, apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ToAPIKeyResponse(apiKey)
+	return &response, nil
+}
+
+// CreateAPIKey creates an API key for the user. The key is returned this once,
+// only its hash is stored.
+func (s *APIKeyService) CreateAPIKey(userID uint, req *types.CreateAPIKeyRequest) (*types.APIKeySecretResponse, error) {
+	scopes, err := s.checkScopes(userID, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, utils.ErrInvalidExpiration
+	}
+
+	apiKeyID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	secret, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	key := APIKeyPrefix + secret
+
+	apiKey := model.APIKey{
+		ID:        apiKeyID,
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   utils.HashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.DB.Create(&apiKey).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAPIKeyCreated, userID, map[string]interface{}{
+		"api_key_id": apiKey.ID,
+		"name":       apiKey.Name,
+		"scopes":     apiKey.Scopes,
+		"expires_at": apiKey.ExpiresAt,
+	})
+
+	return &types.APIKeySecretResponse{
+		APIKey: ToAPIKeyResponse(&apiKey),
+		Key:    key,
+	}, nil
+}
+
+// UpdateAPIKey renames an API key and replaces its scopes
+func (s *APIKeyService) UpdateAPIKey(userID uint, apiKeyID string, req *types.UpdateAPIKeyRequest) (*types.APIKeyResponse, error) {
+	apiKey, err := s.findAPIKey(userID, apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := s.checkScopes(userID, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey.Name = req.Name
+	apiKey.Scopes = scopes
+	if err := s.DB.Save(apiKey).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAPIKeyUpdated, userID, map[string]interface{}{
+		"api_key_id": apiKey.ID,
+		"name":       apiKey.Name,
+		"scopes":     apiKey.Scopes,
+	})
+
+	response := ToAPIKeyResponse(apiKey)
+	return &response, nil
+}
+
+// DeleteAPIKey removes an API key, it is refused from then on
+func (s *APIKeyService) DeleteAPIKey(userID uint, apiKeyID string) error {
+	result := s.DB.Where("id = ? AND user_id = ?", apiKeyID, userID).Delete(&model.APIKey{})
+	if result.Error != nil {
+		return utils.ErrInternalServer
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrAPIKeyNotFound
+	}
+
+	s.audit(model.AuditAPIKeyDeleted, userID, map[string]interface{}{
+		"api_key_id": apiKeyID,
+	})
+	return nil
+}
+
+// AuthenticateAPIKey returns the user of an API key and the token metadata the
+// key stands for. Unknown and expired keys are refused as invalid tokens, the
+// keys of deactivated or deleted accounts like their access tokens.
+func (s *APIKeyService) AuthenticateAPIKey(key string) (*types.AuthenticatedUser, *types.TokenMetadata, error) {
+	var apiKey model.APIKey
+	if err := s.DB.First(&apiKey, "key_hash = ?", utils.HashToken(key)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, utils.ErrInvalidToken
+		}
+		return nil, nil, utils.ErrInternalServer
+	}
+
+	now := time.Now()
+	if apiKey.IsExpired(now) {
+		return nil, nil, utils.ErrInvalidToken
+	}
+
+	var user model.User
+	if err := s.DB.Unscoped().First(&user, apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, utils.ErrUserNotFound
+		}
+		return nil, nil, utils.ErrInternalServer
+	}
+
+	metadata := &types.TokenMetadata{
+		UserID:        user.ID,
+		TokenType:     types.AccessToken,
+		Role:          string(user.Role),
+		EmailVerified: user.IsEmailVerified(),
+		Email:         user.Email,
+		IssuedAt:      apiKey.CreatedAt.Unix(),
+		APIKeyID:      apiKey.ID,
+		Scopes:        strings.Fields(apiKey.Scopes),
+	}
+	if apiKey.ExpiresAt != nil {
+		metadata.ExpiresAt = apiKey.ExpiresAt.Unix()
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return nil, metadata, err
+	}
+
+	if err := s.DB.Model(&model.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-apiKeyLastUsedInterval)).
+		Update("last_used_at", now).Error; err != nil {
+		return nil, nil, utils.ErrInternalServer
+	}
+
+	return &types.AuthenticatedUser{
+		ID:    user.ID,
+		Email: user.Email,
+		Name:  user.Name,
+		Role:  string(user.Role),
+	}, metadata, nil
+}
+
+// checkScopes makes sure the user holds every permission an API key is limited
+// to and returns them space separated, sorted and without duplicates
+func (s *APIKeyService) checkScopes(userID uint, scopes []string) (string, error) {
+	permissions, err := s.RBAC.GetUserPermissions(userID)
+	if err != nil {
+		return "", err
+	}
+
+	held := make(map[string]struct{}, len(permissions))
+	for _, permission := range permissions {
+		held[permission] = struct{}{}
+	}
+
+	requested := make(map[string]struct{}, len(scopes))
+	for _, scope := range scopes {
+		if _, ok := held[scope]; !ok {
+			return "", utils.ErrInvalidAPIKeyScope
+		}
+		requested[scope] = struct{}{}
+	}
+
+	normalized := make([]string, 0, len(requested))
+	for scope := range requested {
+		normalized = append(normalized, scope)
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, " "), nil
+}
+
+func (s *APIKeyService) findAPIKey(userID uint, apiKeyID string) (*model.APIKey, error) {
+	var apiKey model.APIKey
+	if err := s.DB.First(&apiKey, "id = ? AND user_id = ?", apiKeyID, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrAPIKeyNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &apiKey, nil
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"strings"
+)
+
+const (
+	defaultAuditPageSize = 50
+	// auditBatchSize is the number of events read at once by the export and the verification
+	auditBatchSize = 500
+)
+
+// AuditService reads the audit log for administrators
+type AuditService struct {
+	db      *gorm.DB
+	hashKey []byte
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{
+		db:      config.DB,
+		hashKey: []byte(config.AppConfig.Audit.HashKey),
+	}
+}
+
+// ToAuditEventResponse converts a model.AuditEvent to its representation in the API
+func ToAuditEventResponse(event *model.AuditEvent) types.AuditEventResponse {
+	return types.AuditEventResponse{
+		ID:        event.ID,
+		Type:      string(event.Type),
+		Outcome:   string(event.Outcome),
+		ActorID:   event.ActorID,
+		UserID:    event.UserID,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		Details:   json.RawMessage(event.Details),
+		CreatedAt: event.CreatedAt,
+		PrevHash:  event.PrevHash,
+		Hash:      event.Hash,
+	}
+}
+
+// ListEvents returns one page of audit events, newest first. The cursor is
+// the opaque next_cursor of the previous page.
+func (s *AuditService) ListEvents(query *types.ListAuditEventsQuery) (*types.AuditEventListResponse, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultAuditPageSize
+	}
+
+	db := filterAuditEvents(s.db.Model(&model.AuditEvent{}), &query.AuditEventFilter)
+	if query.Cursor != "" {
+		lastID, err := decodeIDCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("id < ?", lastID)
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	var events []model.AuditEvent
+	if err := db.Order("id DESC").Limit(limit + 1).Find(&events).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	response := &types.AuditEventListResponse{Events: make([]types.AuditEventResponse, 0, limit)}
+	if len(events) > limit {
+		events = events[:limit]
+		response.NextCursor = encodeIDCursor(events[limit-1].ID)
+	}
+	for i := range events {
+		response.Events = append(response.Events, ToAuditEventResponse(&events[i]))
+	}
+
+	return response, nil
+}
+
+// ExportEvents writes the matching audit events to w as JSON lines, oldest
+// first, reading them in batches
+func (s *AuditService) ExportEvents(query *types.ExportAuditEventsQuery, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	lastID := query.AfterID
+	for {
+		var events []model.AuditEvent
+		if err := filterAuditEvents(s.db.Model(&model.AuditEvent{}), &query.AuditEventFilter).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(auditBatchSize).
+			Find(&events).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+
+		for i := range events {
+			if err := encoder.Encode(ToAuditEventResponse(&events[i])); err != nil {
+				return err
+			}
+		}
+
+		if len(events) < auditBatchSize {
+			return nil
+		}
+		lastID = events[len(events)-1].ID
+	}
+}
+
+// VerifyChain recomputes the hash of every event and checks that the events
+// follow each other without gaps up to the chain head
+func (s *AuditService) VerifyChain() (*types.AuditChainVerification, error) {
+	result := &types.AuditChainVerification{Valid: true}
+	broken := func(id uint64, reason string) (*types.AuditChainVerification, error) {
+		result.Valid = false
+		result.BrokenAt = &id
+		result.Reason = reason
+		return result, nil
+	}
+
+	var lastID uint64
+	var lastHash string
+	for {
+		var events []model.AuditEvent
+		if err := s.db.Where("id > ?", lastID).Order("id").Limit(auditBatchSize).Find(&events).Error; err != nil {
+			return nil, utils.ErrInternalServer
+		}
+
+		for i := range events {
+			event := &events[i]
+			if event.ID != lastID+1 {
+				return broken(lastID+1, fmt.Sprintf("event %d is missing", lastID+1))
+			}
+			if event.PrevHash != lastHash {
+				return broken(event.ID, "previous hash does not match")
+			}
+			if event.Hash != hashAuditEvent(event, s.hashKey) {
+				return broken(event.ID, "hash does not match the event")
+			}
+
+			lastID = event.ID
+			lastHash = event.Hash
+			result.Events++
+		}
+
+		if len(events) < auditBatchSize {
+			break
+		}
+	}
+
+	// Events removed from the end of the log leave the head pointing past the last one
+	var head model.AuditChainHead
+	if err := s.db.First(&head, auditChainHeadID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrInternalServer
+	}
+	if head.LastEventID != lastID || head.LastHash != lastHash {
+		return broken(lastID+1, "events after the last one are missing")
+	}
+
+	return result, nil
+}
+
+// filterAuditEvents applies the filters shared by the listing and the export
+func filterAuditEvents(db *gorm.DB, filter *types.AuditEventFilter) *gorm.DB {
+	if filter.Type != "" {
+		var conditions []string
+		var args []interface{}
+		for _, eventType := range strings.Split(filter.Type, ",") {
+			eventType = strings.TrimSpace(eventType)
+			if prefix, ok := strings.CutSuffix(eventType, "*"); ok {
+				conditions = append(conditions, "type LIKE ?")
+				args = append(args, escapeLike(prefix)+"%")
+			} else if eventType != "" {
+				conditions = append(conditions, "type = ?")
+				args = append(args, eventType)
+			}
+		}
+		if len(conditions) > 0 {
+			db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		}
+	}
+	if filter.Outcome != "" {
+		db = db.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.ActorID != nil {
+		db = db.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.UserID != nil {
+		db = db.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.IPAddress != "" {
+		db = db.Where("ip_address = ?", filter.IPAddress)
+	}
+	if filter.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	return db
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
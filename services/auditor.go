@@ -0,0 +1,213 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"log"
+	"time"
+)
+
+// auditChainHeadID is the id of the single row of audit_chain_heads
+const auditChainHeadID = 1
+
+// AuditEntry describes an event to record in the audit log
+type AuditEntry struct {
+	Type    model.AuditEventType
+	Outcome model.AuditOutcome
+	// ActorID is the user who performed the action, if known
+	ActorID *uint
+	// UserID is the user the event concerns, if any
+	UserID  *uint
+	Client  types.ClientInfo
+	Details map[string]interface{}
+}
+
+// Auditor records security relevant events
+type Auditor interface {
+	Record(entry AuditEntry) error
+}
+
+// NewAuditor returns the auditor shared by the services and the middleware
+func NewAuditor() Auditor {
+	return NewGormAuditor(config.DB, config.AppConfig.Audit.HashKey)
+}
+
+// RecordAudit records an event. A failure is logged but does not fail the
+// audited action, which already happened.
+func RecordAudit(auditor Auditor, entry AuditEntry) {
+	if err := auditor.Record(entry); err != nil {
+		log.Printf("Failed to record audit event %s: %v", entry.Type, err)
+	}
+}
+
+// auditUserID returns a pointer for the ActorID and UserID of an AuditEntry
+func auditUserID(id uint) *uint {
+	return &id
+}
+
+// GormAuditor appends the events to the audit_events table, chaining each
+// one to the previous by its hash
+type GormAuditor struct {
+	db      *gorm.DB
+	hashKey []byte
+}
+
+func NewGormAuditor(db *gorm.DB, hashKey string) *GormAuditor {
+	return &GormAuditor{db: db, hashKey: []byte(hashKey)}
+}
+
+// Record appends the event. Appends are serialized by locking the chain head,
+// so every event gets the next id and the hash of its predecessor.
+func (a *GormAuditor) Record(entry AuditEntry) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	encodedDetails, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		head := model.AuditChainHead{ID: auditChainHeadID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&head).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, auditChainHeadID).Error; err != nil {
+			return err
+		}
+
+		event := model.AuditEvent{
+			ID:        head.LastEventID + 1,
+			Type:      entry.Type,
+			Outcome:   entry.Outcome,
+			ActorID:   entry.ActorID,
+			UserID:    entry.UserID,
+			IPAddress: entry.Client.IPAddress,
+			UserAgent: entry.Client.UserAgent,
+			Details:   string(encodedDetails),
+			// Postgres keeps microseconds, the hash must cover what is stored
+			CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+			PrevHash:  head.LastHash,
+		}
+		event.Hash = hashAuditEvent(&event, a.hashKey)
+
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&head).Updates(map[string]interface{}{
+			"last_event_id": event.ID,
+			"last_hash":     event.Hash,
+		}).Error
+	})
+}
+
+// hashAuditEvent hashes every field of the event but its own hash. With a key
+// the hash is an HMAC.
+func hashAuditEvent(event *model.AuditEvent, key []byte) string {
+	// Struct fields are encoded in order, which keeps the encoding stable
+	encoded, _ := json.Marshal(struct {
+		ID        uint64               `json:"id"`
+		Type      model.AuditEventType `json:"type"`
+		Outcome   model.AuditOutcome   `json:"outcome"`
+		ActorID   *uint                `json:"actor_id"`
+		UserID    *uint                `json:"user_id"`
+		IPAddress string               `json:"ip_address"`
+		UserAgent string               `json:"user_agent"`
+		Details   string               `json:"details"`
+		CreatedAt string               `json:"created_at"`
+		PrevHash  string               `json:"prev_hash"`
+	}{
+		ID:        event.ID,
+		Type:      event.Type,
+		Outcome:   event.Outcome,
+		ActorID:   event.ActorID,
+		UserID:    event.UserID,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		Details:   event.Details,
+		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PrevHash:  event.PrevHash,
+	})
+
+	if len(key) == 0 {
+		sum := sha256.Sum256(encoded)
+		return hex.EncodeToString(sum[:])
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auditReason returns the error code of a failed action for the details of its event
+func auditReason(err error) string {
+	_, response := utils.GetErrorResponse(err)
+	return response.Code
+}
+
+// audit records an action of the user on their own account
+func (s *AuthService) audit(eventType model.AuditEventType, outcome model.AuditOutcome, userID uint, client types.ClientInfo, details map[string]interface{}) {
+	entry := AuditEntry{
+		Type:    eventType,
+		Outcome: outcome,
+		Client:  client,
+		Details: details,
+	}
+	if userID != 0 {
+		entry.ActorID = auditUserID(userID)
+		entry.UserID = entry.ActorID
+	}
+	RecordAudit(s.auditor, entry)
+}
+
+// audit records a successful change of an account, by its user or by an administrator
+func (s *UsersService) audit(eventType model.AuditEventType, actorID, userID uint, details map[string]interface{}) {
+	RecordAudit(s.Auditor, AuditEntry{
+		Type:    eventType,
+		Outcome: model.AuditSuccess,
+		ActorID: auditUserID(actorID),
+		UserID:  auditUserID(userID),
+		Details: details,
+	})
+}
+
+// audit records a successful change of an OAuth client by an administrator
+func (s *OAuthClientService) audit(eventType model.AuditEventType, actorID uint, details map[string]interface{}) {
+	RecordAudit(s.Auditor, AuditEntry{
+		Type:    eventType,
+		Outcome: model.AuditSuccess,
+		ActorID: auditUserID(actorID),
+		Details: details,
+	})
+}
+
+// audit records a successful change of a service account by an administrator
+func (s *ServiceAccountService) audit(eventType model.AuditEventType, actorID uint, details map[string]interface{}) {
+	RecordAudit(s.Auditor, AuditEntry{
+		Type:    eventType,
+		Outcome: model.AuditSuccess,
+		ActorID: auditUserID(actorID),
+		Details: details,
+	})
+}
+
+// audit records a successful change of an API key by its user
+func (s *APIKeyService) audit(eventType model.AuditEventType, userID uint, details map[string]interface{}) {
+	RecordAudit(s.Auditor, AuditEntry{
+		Type:    eventType,
+		Outcome: model.AuditSuccess,
+		ActorID: auditUserID(userID),
+		UserID:  auditUserID(userID),
+		Details: details,
+	})
+}
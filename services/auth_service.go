@@ -2,35 +2,59 @@ package services
 
 import (
 	"errors"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"gorm.io/gorm"
 	"jwt-auth-app/config"
 	"jwt-auth-app/model"
 	"jwt-auth-app/types"
 	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/mailer"
+	"log"
+	"time"
 )
 
 type AuthService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	revocations    RevocationStore
+	loginAttempts  LoginAttemptStore
+	passwords      *utils.PasswordManager
+	passwordPolicy *utils.PasswordPolicy
+	mailer         mailer.Mailer
+	webAuthn       *webauthn.WebAuthn
+	rbac           *RBACService
+	auditor        Auditor
 }
 
 func NewAuthService() *AuthService {
 	return &AuthService{
-		db: config.DB,
+		db:             config.DB,
+		revocations:    NewGormRevocationStore(config.DB),
+		loginAttempts:  newLoginAttemptStore(config.DB),
+		passwords:      utils.GetPasswordManager(),
+		passwordPolicy: utils.GetPasswordPolicy(),
+		mailer:         mailer.GetMailer(),
+		webAuthn:       utils.GetWebAuthn(),
+		rbac:           NewRBACService(),
+		auditor:        NewAuditor(),
 	}
 }
 
-func (s *AuthService) Register(req *types.RegisterRequest) (*types.AuthResponse, error) {
+func (s *AuthService) Register(req *types.RegisterRequest, client types.ClientInfo) (*types.AuthResponse, error) {
+	if err := s.passwordPolicy.Validate("password", req.Password, req.Email, req.Name); err != nil {
+		return nil, err
+	}
+
 	// Check if user exists
+	// Deleted accounts keep their email address, so they are included in the check
 	var existingUser model.User
-	if err := s.db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := s.db.Unscoped().Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
 		return nil, utils.ErrUserExists
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, utils.ErrInternalServer
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.Hash(req.Password)
 	if err != nil {
 		return nil, utils.ErrInternalServer
 	}
@@ -38,57 +62,266 @@ func (s *AuthService) Register(req *types.RegisterRequest) (*types.AuthResponse,
 	// Create user
 	user := model.User{
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Name:     req.Name,
+		Role:     model.RoleUser,
+		IsActive: true,
 	}
 
 	if err := s.db.Create(&user).Error; err != nil {
 		return nil, utils.ErrInternalServer
 	}
 
+	s.audit(model.AuditUserRegistered, model.AuditSuccess, user.ID, client, map[string]interface{}{
+		"email": user.Email,
+	})
+
+	// The user can ask for a new link, so a failed email does not fail the registration
+	if err := s.sendVerificationEmail(&user); err != nil {
+		log.Println("Failed to send verification email:", err)
+	}
+
+	if err := checkEmailVerification(&user); err != nil {
+		return &types.AuthResponse{User: ToUserResponse(&user)}, nil
+	}
+
 	// Generate tokens
-	tokens, err := utils.GenerateTokenPair(user.ID)
+	tokens, err := s.issueTokens(&user, client, authMethodPassword)
 	if err != nil {
-		return nil, utils.ErrInternalServer
+		return nil, err
 	}
 
 	return &types.AuthResponse{
-		User: types.UserResponse{
-			ID:    user.ID,
-			Email: user.Email,
-			Name:  user.Name,
-		},
-		Token: *tokens,
+		User:  ToUserResponse(&user),
+		Token: tokens,
 	}, nil
 }
 
-func (s *AuthService) Login(req *types.LoginRequest) (*types.AuthResponse, error) {
-	// Find user
+// Login checks the credentials of a user. Failed attempts are counted per
+// account and per client IP address, and lock both for a while once there are too many.
+func (s *AuthService) Login(req *types.LoginRequest, client types.ClientInfo) (*types.AuthResponse, error) {
+	response, userID, err := s.login(req, client)
+	if err != nil {
+		s.audit(model.AuditLoginFailed, model.AuditFailure, userID, client, map[string]interface{}{
+			"method": "password",
+			"email":  req.Email,
+			"reason": auditReason(err),
+		})
+		return nil, err
+	}
+
+	// Logins waiting for a second factor are recorded once it is verified
+	if response.Token != nil {
+		s.audit(model.AuditLoginSucceeded, model.AuditSuccess, userID, client, map[string]interface{}{
+			"method":     "password",
+			"session_id": response.Token.RefreshTokenMetadata.FamilyID,
+		})
+	}
+	return response, nil
+}
+
+// login implements Login. It also returns the id of the user once the email
+// address is known, so failures can be audited.
+func (s *AuthService) login(req *types.LoginRequest, client types.ClientInfo) (*types.AuthResponse, uint, error) {
+	now := time.Now()
+	if err := s.checkLoginLocked(now, accountAttemptKey(req.Email), ipAttemptKey(client.IPAddress)); err != nil {
+		return nil, 0, err
+	}
+
+	// Find user, including deleted ones so they get a distinct error
 	var user model.User
-	if err := s.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := s.db.Unscoped().Where("email = ?", req.Email).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, utils.ErrInvalidCredentials
+			return nil, 0, s.recordLoginFailure(utils.ErrInvalidCredentials, req.Email, client.IPAddress, now)
 		}
-		return nil, utils.ErrInternalServer
+		return nil, 0, utils.ErrInternalServer
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, utils.ErrInvalidCredentials
+	match, needsRehash, err := s.passwords.Verify(req.Password, user.Password)
+	if err != nil {
+		log.Println("Failed to verify password hash:", err)
+		return nil, user.ID, utils.ErrInternalServer
+	}
+	if !match {
+		return nil, user.ID, s.recordLoginFailure(utils.ErrInvalidCredentials, req.Email, client.IPAddress, now)
+	}
+	if needsRehash {
+		s.rehashPassword(&user, req.Password)
+	}
+
+	// Only reveal the account status to someone who knows the password
+	if err := checkLoginAllowed(&user); err != nil {
+		return nil, user.ID, err
+	}
+
+	// Users with two-factor authentication get a challenge instead of the tokens
+	challenge, err := s.startMFAChallenge(&user)
+	if err != nil {
+		return nil, user.ID, err
+	}
+	if challenge != "" {
+		return &types.AuthResponse{
+			User:     ToUserResponse(&user),
+			MFAToken: challenge,
+		}, user.ID, nil
 	}
 
 	// Generate tokens
-	tokens, err := utils.GenerateTokenPair(user.ID)
+	tokens, err := s.issueTokens(&user, client, authMethodPassword)
 	if err != nil {
-		return nil, utils.ErrInternalServer
+		return nil, user.ID, err
 	}
 
+	s.resetLoginFailures(req.Email)
+
 	return &types.AuthResponse{
-		User: types.UserResponse{
-			ID:    user.ID,
-			Email: user.Email,
-			Name:  user.Name,
-		},
-		Token: *tokens,
-	}, nil
+		User:  ToUserResponse(&user),
+		Token: tokens,
+	}, user.ID, nil
+}
+
+// rehashPassword replaces the hash of a verified password with one of the
+// current algorithm and parameters. Failures only delay the upgrade.
+func (s *AuthService) rehashPassword(user *model.User, password string) {
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		log.Println("Failed to rehash password:", err)
+		return
+	}
+
+	// Leave the hash alone if the password was changed in the meantime
+	if err := s.db.Model(&model.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashedPassword).Error; err != nil {
+		log.Println("Failed to store rehashed password:", err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// checkLoginAllowed refuses users who cannot log in whatever their credentials
+func checkLoginAllowed(user *model.User) error {
+	if err := checkAccountStatus(user); err != nil {
+		return err
+	}
+
+	if user.PasswordResetRequired {
+		return utils.ErrPasswordResetRequired
+	}
+
+	return checkEmailVerification(user)
+}
+
+// RefreshToken exchanges a valid refresh token for a new token pair. Every
+// refresh token can only be used once.
+func (s *AuthService) RefreshToken(refreshToken string, client types.ClientInfo) (*types.TokenPair, error) {
+	return s.refreshToken(refreshToken, "", client)
+}
+
+// refreshToken implements RefreshToken for the sessions of this API's own
+// login, or of the OAuth client given by its id
+func (s *AuthService) refreshToken(refreshToken, oauthClientID string, client types.ClientInfo) (*types.TokenPair, error) {
+	metadata, err := utils.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, utils.ErrInvalidRefreshToken
+	}
+
+	// Load the user so the new access token carries the current role
+	var user model.User
+	if err := s.db.Unscoped().First(&user, metadata.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidRefreshToken
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return nil, err
+	}
+
+	if err := checkEmailVerification(&user); err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.revocations.IsRevoked(metadata)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	if revoked {
+		return nil, utils.ErrTokenRevoked
+	}
+
+	// Tokens issued before families were introduced are exchanged once for a new family
+	var tokens *types.TokenPair
+	if metadata.FamilyID == "" {
+		if oauthClientID != "" {
+			return nil, utils.ErrInvalidRefreshToken
+		}
+		if err := s.revocations.Revoke(metadata); err != nil {
+			return nil, utils.ErrInternalServer
+		}
+		tokens, err = s.issueTokens(&user, client)
+	} else {
+		tokens, err = s.rotateRefreshToken(&user, metadata, oauthClientID, client)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"session_id": tokens.RefreshTokenMetadata.FamilyID,
+	}
+	if oauthClientID != "" {
+		details["client_id"] = oauthClientID
+	}
+	s.audit(model.AuditTokenRefreshed, model.AuditSuccess, user.ID, client, details)
+	return tokens, nil
+}
+
+// Logout revokes the access token used for the request together with its
+// session and, when given, the refresh token of the same session
+func (s *AuthService) Logout(accessToken *types.TokenMetadata, refreshToken string) error {
+	if refreshToken != "" {
+		metadata, err := utils.ValidateRefreshToken(refreshToken)
+		if err != nil || metadata.UserID != accessToken.UserID {
+			return utils.ErrInvalidRefreshToken
+		}
+
+		if err := s.revocations.Revoke(metadata); err != nil {
+			return utils.ErrInternalServer
+		}
+
+		if metadata.FamilyID != "" {
+			if err := s.revokeFamily(metadata.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.revocations.Revoke(accessToken); err != nil {
+		return utils.ErrInternalServer
+	}
+
+	// Other access tokens of the session stop working with it
+	if accessToken.SessionID != "" {
+		if err := s.revokeFamily(accessToken.SessionID); err != nil {
+			return err
+		}
+	}
+
+	s.audit(model.AuditLogout, model.AuditSuccess, accessToken.UserID, types.ClientInfo{}, map[string]interface{}{
+		"session_id": accessToken.SessionID,
+	})
+	return nil
+}
+
+// LogoutAll revokes every access and refresh token issued to the user so far
+func (s *AuthService) LogoutAll(userID uint) error {
+	if err := revokeUserTokens(s.db, s.revocations, userID); err != nil {
+		return err
+	}
+
+	s.audit(model.AuditLogoutAll, model.AuditSuccess, userID, types.ClientInfo{}, nil)
+	return nil
 }
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm/clause"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"strings"
+	"time"
+)
+
+// GrantTypeClientCredentials is the grant of service accounts, RFC 6749 section 4.4
+const GrantTypeClientCredentials = "client_credentials"
+
+// maxClientAssertionLifetime bounds how long a client assertion is valid, and
+// so how long its jti is remembered to refuse it a second time
+const maxClientAssertionLifetime = 5 * time.Minute
+
+// clientCredentials issues an access token to a service account. No refresh
+// token is issued, the account authenticates again instead.
+func (s *AuthService) clientCredentials(req *types.OAuthTokenRequest, client types.ClientInfo) (*types.OAuthTokenResponse, error) {
+	account, err := s.authenticateServiceAccount(req)
+	if err != nil {
+		var oauthErr *utils.OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == utils.OAuthInvalidClient {
+			s.audit(model.AuditServiceAuthFailed, model.AuditFailure, 0, client, map[string]interface{}{
+				"client_id": req.ClientID,
+				"reason":    oauthErr.Description,
+			})
+		}
+		return nil, err
+	}
+
+	// Like a login, the token is limited to the permissions of the account's role
+	scopes, err := s.rbac.GetRolePermissions(account.Role)
+	if err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	accessToken, metadata, err := utils.GenerateAccessToken(types.TokenSubject{
+		ServiceAccountID: account.ID,
+		Role:             account.Role,
+		EmailVerified:    true,
+		Scopes:           scopes,
+	})
+	if err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	if err := s.db.Model(account).Update("last_used_at", time.Now()).Error; err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	s.audit(model.AuditServiceTokenIssued, model.AuditSuccess, 0, client, map[string]interface{}{
+		"service_account_id": account.ID,
+		"token_id":           metadata.TokenID,
+	})
+
+	return &types.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(config.AppConfig.JWT.AccessToken.ExpirationTime.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// authenticateServiceAccount finds the service account of a token request by
+// its secret or by its client assertion. The client_id of the request is
+// filled in from the assertion when it is left out.
+func (s *AuthService) authenticateServiceAccount(req *types.OAuthTokenRequest) (*model.ServiceAccount, error) {
+	usesAssertion := req.ClientAssertion != "" || req.ClientAssertionType != ""
+	if usesAssertion {
+		if req.ClientSecret != "" {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "Use only one client authentication method")
+		}
+		if req.ClientAssertionType != utils.ClientAssertionType || req.ClientAssertion == "" {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "client_assertion_type must be "+utils.ClientAssertionType+" with a client_assertion")
+		}
+		if req.ClientID == "" {
+			req.ClientID = clientAssertionSubject(req.ClientAssertion)
+		}
+	}
+
+	if req.ClientID == "" {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Client authentication is required")
+	}
+
+	account, err := findServiceAccount(s.db, req.ClientID)
+	if errors.Is(err, utils.ErrServiceAccountNotFound) {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Unknown client")
+	}
+	if err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	if usesAssertion {
+		if !account.UsesKey() {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "The client authenticates with a secret")
+		}
+		if err := s.consumeClientAssertion(account, req.ClientAssertion); err != nil {
+			return nil, err
+		}
+	} else {
+		if account.UsesKey() {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "The client authenticates with a client assertion")
+		}
+		if req.ClientSecret == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(req.ClientSecret)), []byte(account.SecretHash)) != 1 {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Invalid client secret")
+		}
+	}
+
+	// Disabled accounts are only reported once they proved who they are
+	if !account.IsActive {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "The service account is disabled")
+	}
+
+	return account, nil
+}
+
+// consumeClientAssertion verifies a client assertion and records its jti, an
+// assertion is accepted once. Its audience is the token endpoint or the issuer.
+func (s *AuthService) consumeClientAssertion(account *model.ServiceAccount, assertion string) error {
+	issuer := config.AppConfig.JWT.Issuer
+	audiences := []string{strings.TrimSuffix(issuer, "/") + "/oauth/token", issuer}
+
+	claims, err := utils.VerifyClientAssertion(assertion, account.PublicKey, account.ID, audiences, maxClientAssertionLifetime)
+	if err != nil {
+		return utils.NewOAuthError(utils.OAuthInvalidClient, "Invalid client assertion")
+	}
+
+	// Assertions that expired are cleaned up along the way
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&model.ClientAssertion{}).Error; err != nil {
+		return utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.ClientAssertion{
+		JTIHash:   utils.HashToken(account.ID + ":" + claims.ID),
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if result.Error != nil {
+		return utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewOAuthError(utils.OAuthInvalidClient, "The client assertion was already used")
+	}
+	return nil
+}
+
+// clientAssertionSubject reads the client a client assertion names itself as,
+// before it is verified with the key of that client
+func clientAssertionSubject(assertion string) string {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/mailer"
+)
+
+const testPassword = "correct horse battery"
+
+// newTestDB opens an in-memory SQLite database with the tables of the auth
+// flows and makes it config.DB, the database of the New* constructors
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(
+		&model.User{},
+		&model.Role{},
+		&model.Permission{},
+		&model.UserRoleAssignment{},
+		&model.RevokedToken{},
+		&model.UserTokenRevocation{},
+		&model.RefreshTokenFamily{},
+		&model.RefreshToken{},
+		&model.LoginAttempt{},
+		&model.PasswordResetToken{},
+		&model.UserTOTP{},
+		&model.WebAuthnCredential{},
+		&model.WebAuthnSession{},
+		&model.AuditEvent{},
+		&model.AuditChainHead{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	config.DB = db
+	return db
+}
+
+// initTestTokens signs the tokens of the test with a fresh HS256 secret
+func initTestTokens(t *testing.T) {
+	t.Helper()
+
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretPath, []byte(strings.Repeat("s", 32)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenConfig := config.TokenConfig{KeyID: "test", SecretPath: secretPath, ExpirationTime: time.Hour}
+	config.AppConfig.JWT = config.JWTConfig{
+		Algorithm:    "HS256",
+		Issuer:       "https://auth.example.com",
+		AccessToken:  tokenConfig,
+		RefreshToken: tokenConfig,
+	}
+	if err := utils.InitializeJWTManager(&config.AppConfig.JWT); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestAuthService returns an AuthService on a fresh database that keeps
+// revocations in memory and drops its emails into mailDir
+func newTestAuthService(t *testing.T) (svc *AuthService, mailDir string) {
+	t.Helper()
+
+	db := newTestDB(t)
+	initTestTokens(t)
+
+	passwordConfig := &config.PasswordConfig{
+		HashAlgorithm:     config.PasswordHashBcrypt,
+		BcryptCost:        4,
+		Argon2Memory:      1024,
+		Argon2Time:        1,
+		Argon2Parallelism: 1,
+		MinLength:         8,
+		MaxLength:         128,
+		ResetExpiration:   time.Hour,
+	}
+	config.AppConfig.Password = *passwordConfig
+	config.AppConfig.Lockout = config.LockoutConfig{
+		Store:              config.LoginAttemptStorePostgres,
+		MaxAccountFailures: 5,
+		MaxIPFailures:      50,
+		FailureWindow:      time.Minute,
+		Duration:           time.Minute,
+		MaxDuration:        time.Hour,
+		ResetAfter:         time.Hour,
+	}
+	config.AppConfig.EmailVerification = config.EmailVerificationConfig{Policy: config.EmailVerificationBlock, Expiration: time.Hour}
+
+	passwords, err := utils.NewPasswordManager(passwordConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordPolicy, err := utils.NewPasswordPolicy(passwordConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailDir = t.TempDir()
+	fileMailer, err := mailer.NewFileMailer("auth@example.com", mailDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc = NewAuthService()
+	svc.db = db
+	svc.revocations = NewMemoryRevocationStore()
+	svc.passwords = passwords
+	svc.passwordPolicy = passwordPolicy
+	svc.mailer = fileMailer
+	return svc, mailDir
+}
+
+// createTestUser registers a verified user with testPassword
+func createTestUser(t *testing.T, svc *AuthService, email string) *model.User {
+	t.Helper()
+
+	hashedPassword, err := svc.passwords.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	user := model.User{
+		Email:           email,
+		Password:        hashedPassword,
+		Name:            "Test User",
+		Role:            model.RoleUser,
+		IsActive:        true,
+		EmailVerifiedAt: &now,
+	}
+	if err := svc.db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// login logs the user in with testPassword and returns the issued tokens
+func login(t *testing.T, svc *AuthService, email string) *types.TokenPair {
+	t.Helper()
+
+	response, err := svc.Login(&types.LoginRequest{Email: email, Password: testPassword}, types.ClientInfo{IPAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if response.Token == nil {
+		t.Fatal("login: no tokens issued")
+	}
+	return response.Token
+}
+
+// validateAccessToken validates an access token the way the JWT middleware
+// does and returns the error it refuses the token with
+func validateAccessToken(t *testing.T, svc *AuthService, accessToken string) error {
+	t.Helper()
+
+	metadata, err := utils.ValidateAccessToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	users := NewUsersService()
+	users.Revocations = svc.revocations
+	_, err = users.GetTokenUser(metadata)
+	return err
+}
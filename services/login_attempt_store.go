@@ -0,0 +1,189 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy decides when repeated failures lock a key and for how long
+type LockoutPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	// BaseLockout is the duration of the first lockout, every consecutive one doubles it
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// ResetAfter forgets the lockout history of a key without failures for that long
+	ResetAfter time.Duration
+}
+
+// lockoutDuration returns the duration of the nth consecutive lockout
+func (p LockoutPolicy) lockoutDuration(lockouts int) time.Duration {
+	duration := p.BaseLockout
+	for i := 1; i < lockouts && duration < p.MaxLockout; i++ {
+		duration *= 2
+	}
+	if duration > p.MaxLockout {
+		duration = p.MaxLockout
+	}
+	return duration
+}
+
+// recordFailure applies a failed attempt to the counters of a key and returns
+// until when the key is locked, zero if it is not
+func (p LockoutPolicy) recordFailure(attempt *model.LoginAttempt, now time.Time) time.Time {
+	if now.Sub(attempt.UpdatedAt) > p.ResetAfter {
+		attempt.Lockouts = 0
+	}
+	if now.Sub(attempt.WindowStart) > p.Window {
+		attempt.Failures = 0
+		attempt.WindowStart = now
+	}
+
+	attempt.Failures++
+	attempt.UpdatedAt = now
+
+	if attempt.Failures < p.MaxFailures {
+		return time.Time{}
+	}
+
+	attempt.Lockouts++
+	attempt.Failures = 0
+	attempt.WindowStart = now
+	lockedUntil := now.Add(p.lockoutDuration(attempt.Lockouts))
+	attempt.LockedUntil = &lockedUntil
+	return lockedUntil
+}
+
+// LoginAttemptStore counts failed logins per key, e.g. per account or per client IP
+type LoginAttemptStore interface {
+	// LockedUntil returns until when the key is locked, zero if it is not
+	LockedUntil(key string, now time.Time) (time.Time, error)
+	// RecordFailure counts a failed attempt and returns until when the key is
+	// locked because of it, zero if it is not
+	RecordFailure(key string, policy LockoutPolicy, now time.Time) (time.Time, error)
+	// Reset forgets the failures and lockouts of the key
+	Reset(key string) error
+}
+
+// sharedMemoryLoginAttempts is used by every service when LOGIN_ATTEMPT_STORE
+// is memory, so the counters of login and admin unlock are the same
+var sharedMemoryLoginAttempts = NewMemoryLoginAttemptStore()
+
+// newLoginAttemptStore returns the store selected by LOGIN_ATTEMPT_STORE
+func newLoginAttemptStore(db *gorm.DB) LoginAttemptStore {
+	if config.AppConfig.Lockout.Store == config.LoginAttemptStoreMemory {
+		return sharedMemoryLoginAttempts
+	}
+	return NewGormLoginAttemptStore(db)
+}
+
+// GormLoginAttemptStore persists the counters in Postgres, so they are shared
+// between instances
+type GormLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewGormLoginAttemptStore(db *gorm.DB) *GormLoginAttemptStore {
+	return &GormLoginAttemptStore{db: db}
+}
+
+func (s *GormLoginAttemptStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	var attempt model.LoginAttempt
+	result := s.db.Where("key = ?", key).Limit(1).Find(&attempt)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	if result.RowsAffected == 0 || attempt.LockedUntil == nil || !attempt.LockedUntil.After(now) {
+		return time.Time{}, nil
+	}
+	return *attempt.LockedUntil, nil
+}
+
+func (s *GormLoginAttemptStore) RecordFailure(key string, policy LockoutPolicy, now time.Time) (time.Time, error) {
+	// Counters the policy would start over anyway are cleaned up along the way
+	stale := now.Add(-policy.ResetAfter)
+	if err := s.db.Where("updated_at < ? AND (locked_until IS NULL OR locked_until < ?)", stale, now).
+		Delete(&model.LoginAttempt{}).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	var lockedUntil time.Time
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists, then lock it so concurrent failures are all counted
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.LoginAttempt{
+			Key:         key,
+			WindowStart: now,
+			UpdatedAt:   now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var attempt model.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&attempt).Error; err != nil {
+			return err
+		}
+
+		lockedUntil = policy.recordFailure(&attempt, now)
+		return tx.Save(&attempt).Error
+	})
+	return lockedUntil, err
+}
+
+func (s *GormLoginAttemptStore) Reset(key string) error {
+	return s.db.Where("key = ?", key).Delete(&model.LoginAttempt{}).Error
+}
+
+// MemoryLoginAttemptStore keeps the counters in memory, it is meant for tests
+// and single instance development setups
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*model.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		attempts: make(map[string]*model.LoginAttempt),
+	}
+}
+
+func (s *MemoryLoginAttemptStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok || attempt.LockedUntil == nil || !attempt.LockedUntil.After(now) {
+		return time.Time{}, nil
+	}
+	return *attempt.LockedUntil, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(key string, policy LockoutPolicy, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, a := range s.attempts {
+		if now.Sub(a.UpdatedAt) > policy.ResetAfter && (a.LockedUntil == nil || a.LockedUntil.Before(now)) {
+			delete(s.attempts, k)
+		}
+	}
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &model.LoginAttempt{Key: key, WindowStart: now, UpdatedAt: now}
+		s.attempts[key] = attempt
+	}
+
+	return policy.recordFailure(attempt, now), nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"jwt-auth-app/config"
+	"jwt-auth-app/utils"
+	"log"
+	"strings"
+	"time"
+)
+
+// accountAttemptKey identifies the failed logins of an email address, whether
+// or not an account uses it, so lockouts do not reveal registered addresses
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipAttemptKey identifies the failed logins of a client IP across accounts
+func ipAttemptKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+func accountLockoutPolicy() LockoutPolicy {
+	cfg := config.AppConfig.Lockout
+	return LockoutPolicy{
+		MaxFailures: cfg.MaxAccountFailures,
+		Window:      cfg.FailureWindow,
+		BaseLockout: cfg.Duration,
+		MaxLockout:  cfg.MaxDuration,
+		ResetAfter:  cfg.ResetAfter,
+	}
+}
+
+func ipLockoutPolicy() LockoutPolicy {
+	policy := accountLockoutPolicy()
+	policy.MaxFailures = config.AppConfig.Lockout.MaxIPFailures
+	return policy
+}
+
+// checkLoginLocked refuses the attempt while any of the keys is locked
+func (s *AuthService) checkLoginLocked(now time.Time, keys ...string) error {
+	var lockedUntil time.Time
+	for _, key := range keys {
+		until, err := s.loginAttempts.LockedUntil(key, now)
+		if err != nil {
+			return utils.ErrInternalServer
+		}
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+
+	if lockedUntil.IsZero() {
+		return nil
+	}
+	return &utils.LockedError{RetryAfter: lockedUntil.Sub(now)}
+}
+
+// recordLoginFailure counts a failed attempt against the account and, when
+// given, the client IP. It returns the error of the attempt, which becomes a
+// lockout when this failure reached a threshold.
+func (s *AuthService) recordLoginFailure(attemptErr error, email, clientIP string, now time.Time) error {
+	lockedUntil, err := s.loginAttempts.RecordFailure(accountAttemptKey(email), accountLockoutPolicy(), now)
+	if err != nil {
+		log.Println("Failed to record login failure:", err)
+	}
+
+	if clientIP != "" {
+		ipLockedUntil, err := s.loginAttempts.RecordFailure(ipAttemptKey(clientIP), ipLockoutPolicy(), now)
+		if err != nil {
+			log.Println("Failed to record login failure:", err)
+		}
+		if ipLockedUntil.After(lockedUntil) {
+			lockedUntil = ipLockedUntil
+		}
+	}
+
+	if lockedUntil.IsZero() {
+		return attemptErr
+	}
+	return &utils.LockedError{RetryAfter: lockedUntil.Sub(now)}
+}
+
+// resetLoginFailures forgets the failures of the account after a successful
+// login. The client IP keeps its counter, otherwise an attacker could reset
+// it with an account of their own.
+func (s *AuthService) resetLoginFailures(email string) {
+	if err := s.loginAttempts.Reset(accountAttemptKey(email)); err != nil {
+		log.Println("Failed to reset login failures:", err)
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// EnrollTOTP starts a TOTP enrollment with a new secret. Two-factor
+// authentication stays disabled until ConfirmTOTP receives a valid code.
+func (s *AuthService) EnrollTOTP(userID uint) (*types.TOTPEnrollmentResponse, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	totp, err := s.getTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp != nil && totp.IsEnabled() {
+		return nil, utils.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	// Starting over replaces the secret of an unconfirmed enrollment
+	enrollment := model.UserTOTP{
+		UserID: userID,
+		Secret: secret,
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "created_at"}),
+	}).Create(&enrollment).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	uri := utils.TOTPURI(config.AppConfig.MFA.Issuer, user.Email, secret)
+	png, err := utils.TOTPQRCode(uri)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return &types.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proved their
+// authenticator works, and returns the recovery codes. They are only shown once.
+func (s *AuthService) ConfirmTOTP(userID uint, code string) ([]string, error) {
+	totp, err := s.getTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, utils.ErrMFAEnrollmentNotFound
+	}
+	if totp.IsEnabled() {
+		return nil, utils.ErrMFAAlreadyEnabled
+	}
+
+	step, ok := utils.ValidateTOTPCode(totp.Secret, code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		return nil, utils.ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(totp).Updates(map[string]interface{}{
+			"confirmed_at":   time.Now(),
+			"last_used_step": step,
+		}).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(model.AuditMFAEnabled, model.AuditSuccess, userID, types.ClientInfo{}, nil)
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It requires the password
+// and a second factor, so a stolen access token alone cannot remove it.
+func (s *AuthService) DisableTOTP(userID uint, password, code string) error {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrUserNotFound
+		}
+		return utils.ErrInternalServer
+	}
+
+	match, _, err := s.passwords.Verify(password, user.Password)
+	if err != nil {
+		return utils.ErrInternalServer
+	}
+	if !match {
+		return utils.ErrInvalidCredentials
+	}
+
+	totp, err := s.getEnabledTOTP(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.verifySecondFactor(totp, code); err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+		if err := tx.Delete(totp).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.audit(model.AuditMFADisabled, model.AuditSuccess, userID, types.ClientInfo{}, nil)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user
+func (s *AuthService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	totp, err := s.getEnabledTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(totp, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(model.AuditRecoveryCodesRegenerated, model.AuditSuccess, userID, types.ClientInfo{}, nil)
+	return codes, nil
+}
+
+// VerifyMFA exchanges the challenge returned by Login and a second factor for
+// the token pair. Each challenge can only be used once.
+func (s *AuthService) VerifyMFA(mfaToken, code string, client types.ClientInfo) (*types.AuthResponse, error) {
+	metadata, err := utils.ValidateMFAChallengeToken(mfaToken)
+	if err != nil {
+		return nil, utils.ErrInvalidMFAToken
+	}
+
+	revoked, err := s.revocations.IsRevoked(metadata)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	if revoked {
+		return nil, utils.ErrInvalidMFAToken
+	}
+
+	var user model.User
+	if err := s.db.Unscoped().First(&user, metadata.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidMFAToken
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return nil, err
+	}
+
+	totp, err := s.getEnabledTOTP(user.ID)
+	if errors.Is(err, utils.ErrMFANotEnabled) {
+		return nil, utils.ErrInvalidMFAToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrong codes count against the account like wrong passwords, the
+	// password was already checked so the client IP is left out
+	now := time.Now()
+	if err := s.checkLoginLocked(now, accountAttemptKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(totp, code); err != nil {
+		if errors.Is(err, utils.ErrInvalidMFACode) {
+			err = s.recordLoginFailure(err, user.Email, "", now)
+			s.audit(model.AuditMFAFailed, model.AuditFailure, user.ID, client, map[string]interface{}{
+				"reason": auditReason(err),
+			})
+		}
+		return nil, err
+	}
+
+	if err := s.revocations.Revoke(metadata); err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	tokens, err := s.issueTokens(&user, client, authMethodPassword, authMethodOTP, authMethodMFA)
+	if err != nil {
+		return nil, err
+	}
+
+	s.resetLoginFailures(user.Email)
+
+	s.audit(model.AuditLoginSucceeded, model.AuditSuccess, user.ID, client, map[string]interface{}{
+		"method":     "mfa",
+		"session_id": tokens.RefreshTokenMetadata.FamilyID,
+	})
+
+	return &types.AuthResponse{
+		User:  ToUserResponse(&user),
+		Token: tokens,
+	}, nil
+}
+
+// startMFAChallenge returns a challenge token when the user has two-factor
+// authentication enabled, or an empty string when the password is enough
+func (s *AuthService) startMFAChallenge(user *model.User) (string, error) {
+	totp, err := s.getTOTP(user.ID)
+	if err != nil {
+		return "", err
+	}
+	if totp == nil || !totp.IsEnabled() {
+		return "", nil
+	}
+
+	challenge, err := utils.GenerateMFAChallengeToken(user.ID, config.AppConfig.MFA.ChallengeExpiration)
+	if err != nil {
+		return "", utils.ErrTokenGeneration
+	}
+	return challenge, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func (s *AuthService) verifySecondFactor(totp *model.UserTOTP, code string) error {
+	code = strings.TrimSpace(code)
+
+	if step, ok := utils.ValidateTOTPCode(totp.Secret, code, time.Now(), totp.LastUsedStep); ok {
+		// The conditional update keeps the same code from being accepted twice
+		result := s.db.Model(&model.UserTOTP{}).
+			Where("user_id = ? AND last_used_step < ?", totp.UserID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return utils.ErrInternalServer
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	result := s.db.Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", totp.UserID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return utils.ErrInternalServer
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// getTOTP returns the TOTP enrollment of the user, or nil if there is none
+func (s *AuthService) getTOTP(userID uint) (*model.UserTOTP, error) {
+	var totp model.UserTOTP
+	if err := s.db.First(&totp, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &totp, nil
+}
+
+func (s *AuthService) getEnabledTOTP(userID uint) (*model.UserTOTP, error) {
+	totp, err := s.getTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil || !totp.IsEnabled() {
+		return nil, utils.ErrMFANotEnabled
+	}
+	return totp, nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of the user and generates new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]model.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.GenerateRandomID(8)
+		if err != nil {
+			return nil, utils.ErrInternalServer
+		}
+
+		// Grouped as xxxx-xxxx-xxxx-xxxx to be easier to copy by hand
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		records = append(records, model.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(raw),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes with or without separators and in any case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
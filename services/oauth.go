@@ -0,0 +1,475 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Grant types accepted by the token endpoint
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+var (
+	// codeChallengePattern matches an S256 code challenge, the unpadded
+	// base64url encoding of a SHA-256 hash
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+	// codeVerifierPattern matches a code verifier, RFC 7636 section 4.1
+	codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+)
+
+// Authorize checks an authorization request and returns the consent page the
+// user is sent to. Errors about the client or its redirect URI are returned,
+// the user must not be sent to an unverified URI. Other errors are sent back
+// to the client, the returned URI is then its redirect URI.
+func (s *AuthService) Authorize(req *types.OAuthAuthorizeRequest) (string, error) {
+	_, scopes, err := s.validateAuthorizeRequest(req)
+	if err != nil {
+		var oauthErr *utils.OAuthError
+		if errors.As(err, &oauthErr) {
+			return oauthErrorRedirect(req, oauthErr), nil
+		}
+		return "", err
+	}
+
+	return appendQuery(config.AppConfig.OAuth.ConsentURL, url.Values{
+		"response_type":         {req.ResponseType},
+		"client_id":             {req.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+	}), nil
+}
+
+// GetConsent describes the client of an authorization request and the
+// requested scopes to the user asked to approve it
+func (s *AuthService) GetConsent(accessToken *types.TokenMetadata, req *types.OAuthAuthorizeRequest) (*types.OAuthConsentResponse, error) {
+	if _, err := s.firstPartySession(accessToken); err != nil {
+		return nil, err
+	}
+
+	oauthClient, scopes, err := s.validateAuthorizeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	consent, err := s.findConsent(accessToken.UserID, oauthClient.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.OAuthConsentResponse{
+		ClientID:     oauthClient.ID,
+		ClientName:   oauthClient.Name,
+		Scope:        scopes,
+		ConsentGiven: consent != nil && coversScopes(consent.Scope, scopes),
+	}, nil
+}
+
+// Consent applies the decision of the user on an authorization request and
+// returns the redirect URI of the client, with a single-use authorization
+// code when the user approved it
+func (s *AuthService) Consent(accessToken *types.TokenMetadata, req *types.OAuthConsentRequest, client types.ClientInfo) (string, error) {
+	session, err := s.firstPartySession(accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	userID := accessToken.UserID
+	oauthClient, scopes, err := s.validateAuthorizeRequest(&req.OAuthAuthorizeRequest)
+	if err != nil {
+		var oauthErr *utils.OAuthError
+		if errors.As(err, &oauthErr) {
+			return oauthErrorRedirect(&req.OAuthAuthorizeRequest, oauthErr), nil
+		}
+		return "", err
+	}
+
+	if !*req.Approve {
+		s.audit(model.AuditOAuthDenied, model.AuditSuccess, userID, client, map[string]interface{}{
+			"client_id": oauthClient.ID,
+		})
+		return oauthErrorRedirect(&req.OAuthAuthorizeRequest, utils.NewOAuthError(utils.OAuthAccessDenied, "The user denied the request")), nil
+	}
+
+	// The consent covers every scope the user approved for the client so far
+	consent, err := s.findConsent(userID, oauthClient.ID)
+	if err != nil {
+		return "", err
+	}
+	if consent == nil {
+		consent = &model.OAuthConsent{UserID: userID, ClientID: oauthClient.ID}
+	}
+	consent.Scope = mergeScopes(consent.Scope, scopes)
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scope"}),
+	}).Create(consent).Error; err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	// Expired codes are cleaned up along the way
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&model.OAuthAuthorizationCode{}).Error; err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	code, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	authorizationCode := model.OAuthAuthorizationCode{
+		CodeHash:      utils.HashToken(code),
+		ClientID:      oauthClient.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         req.Nonce,
+		AuthMethods:   session.AuthMethods,
+		AuthTime:      session.AuthTime,
+		ExpiresAt:     time.Now().Add(config.AppConfig.OAuth.CodeExpiration),
+	}
+	if err := s.db.Create(&authorizationCode).Error; err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditOAuthAuthorized, model.AuditSuccess, userID, client, map[string]interface{}{
+		"client_id": oauthClient.ID,
+		"scope":     authorizationCode.Scope,
+	})
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+// Token implements the token endpoint. Errors are *utils.OAuthError.
+func (s *AuthService) Token(req *types.OAuthTokenRequest, client types.ClientInfo) (*types.OAuthTokenResponse, error) {
+	// Service accounts are not OAuth clients, the client credentials grant is theirs alone
+	if req.GrantType == GrantTypeClientCredentials {
+		return s.clientCredentials(req, client)
+	}
+
+	oauthClient, err := s.authenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(oauthClient, req, client)
+	case GrantTypeRefreshToken:
+		if req.RefreshToken == "" {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "refresh_token is required")
+		}
+		tokens, err := s.refreshToken(req.RefreshToken, oauthClient.ID, client)
+		if err != nil {
+			return nil, oauthGrantError(err)
+		}
+		// ID tokens issued on refresh carry no nonce, OpenID Connect Core section 12.2
+		return s.oauthTokenResponse(tokens, "")
+	case "":
+		return nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "grant_type is required")
+	default:
+		return nil, utils.NewOAuthError(utils.OAuthUnsupportedGrantType, "Unsupported grant_type")
+	}
+}
+
+// oauthTokenResponse returns a token pair to an OAuth client, with an ID
+// token when its session was granted the openid scope
+func (s *AuthService) oauthTokenResponse(tokens *types.TokenPair, nonce string) (*types.OAuthTokenResponse, error) {
+	var family model.RefreshTokenFamily
+	if err := s.db.First(&family, "id = ?", tokens.RefreshTokenMetadata.FamilyID).Error; err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	response := &types.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(config.AppConfig.JWT.AccessToken.ExpirationTime.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        family.Scope,
+	}
+
+	if hasScope(family.Scope, ScopeOpenID) {
+		idToken, err := s.generateIDToken(&family, nonce)
+		if err != nil {
+			return nil, oauthGrantError(err)
+		}
+		response.IDToken = idToken
+	}
+	return response, nil
+}
+
+// exchangeAuthorizationCode starts a session of the client for the user who
+// approved it. The code can only be exchanged once, presenting it again
+// revokes the session it started.
+func (s *AuthService) exchangeAuthorizationCode(oauthClient *model.OAuthClient, req *types.OAuthTokenRequest, client types.ClientInfo) (*types.OAuthTokenResponse, error) {
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "code, redirect_uri and code_verifier are required")
+	}
+
+	var code model.OAuthAuthorizationCode
+	if err := s.db.First(&code, "code_hash = ?", utils.HashToken(req.Code)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "The authorization code is invalid")
+		}
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	if code.ClientID != oauthClient.ID {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "The authorization code is invalid")
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "The authorization code expired")
+	}
+
+	// Consuming with a conditional update keeps concurrent exchanges from both succeeding
+	result := s.db.Model(&model.OAuthAuthorizationCode{}).
+		Where("code_hash = ? AND consumed_at IS NULL", code.CodeHash).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+	if result.RowsAffected == 0 {
+		if err := s.revokeCodeSession(&code, client); err != nil {
+			return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+		}
+		return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "The authorization code was already used")
+	}
+
+	if req.RedirectURI != code.RedirectURI {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, code.CodeChallenge) {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	var user model.User
+	if err := s.db.Unscoped().First(&user, code.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidGrant, "The authorization code is invalid")
+		}
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return nil, oauthGrantError(err)
+	}
+	if err := checkEmailVerification(&user); err != nil {
+		return nil, oauthGrantError(err)
+	}
+
+	// The session of the client keeps the authentication that approved it
+	tokens, err := s.startSession(&user, client, sessionOptions{
+		AuthMethods:   strings.Fields(code.AuthMethods),
+		AuthTime:      code.AuthTime,
+		OAuthClientID: oauthClient.ID,
+		Scope:         code.Scope,
+	})
+	if err != nil {
+		return nil, oauthGrantError(err)
+	}
+
+	familyID := tokens.RefreshTokenMetadata.FamilyID
+	if err := s.db.Model(&code).Update("family_id", familyID).Error; err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	s.audit(model.AuditLoginSucceeded, model.AuditSuccess, user.ID, client, map[string]interface{}{
+		"method":     "oauth",
+		"client_id":  oauthClient.ID,
+		"session_id": familyID,
+	})
+	return s.oauthTokenResponse(tokens, code.Nonce)
+}
+
+// firstPartySession returns the session of an access token and refuses the
+// ones issued to OAuth clients, service accounts and API keys, only the
+// sessions of this API's own login can approve a client
+func (s *AuthService) firstPartySession(accessToken *types.TokenMetadata) (*model.RefreshTokenFamily, error) {
+	if accessToken.ServiceAccountID != "" || accessToken.APIKeyID != "" {
+		return nil, utils.ErrForbidden
+	}
+
+	// Tokens issued before sessions were tracked were authenticated when issued
+	if accessToken.SessionID == "" {
+		return &model.RefreshTokenFamily{AuthTime: time.Unix(accessToken.IssuedAt, 0)}, nil
+	}
+
+	var family model.RefreshTokenFamily
+	if err := s.db.First(&family, "id = ?", accessToken.SessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrTokenRevoked
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	if family.ClientID != "" {
+		return nil, utils.ErrForbidden
+	}
+	return &family, nil
+}
+
+// findConsent returns the consent of the user to the client, nil when they
+// never approved it
+func (s *AuthService) findConsent(userID uint, clientID string) (*model.OAuthConsent, error) {
+	var consent model.OAuthConsent
+	if err := s.db.First(&consent, "user_id = ? AND client_id = ?", userID, clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &consent, nil
+}
+
+// revokeCodeSession revokes the session started by an authorization code
+// that was presented again, it may have been intercepted
+func (s *AuthService) revokeCodeSession(code *model.OAuthAuthorizationCode, client types.ClientInfo) error {
+	// The session is recorded after the first exchange consumed the code
+	if err := s.db.First(code, "code_hash = ?", code.CodeHash).Error; err != nil {
+		return err
+	}
+
+	if code.FamilyID != "" {
+		if err := s.revokeFamily(code.FamilyID); err != nil {
+			return err
+		}
+	}
+
+	s.audit(model.AuditOAuthCodeReused, model.AuditFailure, code.UserID, client, map[string]interface{}{
+		"client_id":  code.ClientID,
+		"session_id": code.FamilyID,
+	})
+	return nil
+}
+
+// authenticateOAuthClient finds the client of a token request. Confidential
+// clients must present their secret, public clients have none.
+func (s *AuthService) authenticateOAuthClient(clientID, clientSecret string) (*model.OAuthClient, error) {
+	if clientID == "" {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Client authentication is required")
+	}
+
+	oauthClient, err := findOAuthClient(s.db, clientID)
+	if errors.Is(err, utils.ErrOAuthClientNotFound) {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Unknown client")
+	}
+	if err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	if oauthClient.Type == model.OAuthClientConfidential {
+		if clientSecret == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(clientSecret)), []byte(oauthClient.SecretHash)) != 1 {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Invalid client secret")
+		}
+	} else if clientSecret != "" {
+		return nil, utils.NewOAuthError(utils.OAuthInvalidClient, "Public clients have no secret")
+	}
+
+	return oauthClient, nil
+}
+
+// validateAuthorizeRequest checks an authorization request and returns its
+// client and requested scopes. Only PKCE with S256 is accepted, every client
+// must prove it started the request.
+func (s *AuthService) validateAuthorizeRequest(req *types.OAuthAuthorizeRequest) (*model.OAuthClient, []string, error) {
+	oauthClient, err := findOAuthClient(s.db, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !oauthClient.HasRedirectURI(req.RedirectURI) {
+		return nil, nil, utils.ErrRedirectURIMismatch
+	}
+
+	if req.ResponseType != "code" {
+		return nil, nil, utils.NewOAuthError(utils.OAuthUnsupportedResponseType, "response_type must be code")
+	}
+	if req.CodeChallengeMethod != "S256" {
+		return nil, nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "code_challenge_method must be S256")
+	}
+	if !codeChallengePattern.MatchString(req.CodeChallenge) {
+		return nil, nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "code_challenge must be the base64url encoded SHA-256 hash of the code verifier")
+	}
+	if len(req.Nonce) > maxNonceLength {
+		return nil, nil, utils.NewOAuthError(utils.OAuthInvalidRequest, "nonce is too long")
+	}
+
+	scopes, err := parseScope(req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return oauthClient, scopes, nil
+}
+
+// verifyCodeChallenge checks a code verifier against its S256 challenge
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// oauthGrantError converts an error of the token issuance to the error of the
+// token endpoint
+func oauthGrantError(err error) error {
+	if errors.Is(err, utils.ErrInternalServer) || errors.Is(err, utils.ErrTokenGeneration) {
+		return utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	_, errResponse := utils.GetErrorResponse(err)
+	return utils.NewOAuthError(utils.OAuthInvalidGrant, errResponse.Message)
+}
+
+// oauthErrorRedirect returns the redirect URI of an authorization request
+// with the error in its query
+func oauthErrorRedirect(req *types.OAuthAuthorizeRequest, oauthErr *utils.OAuthError) string {
+	params := url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params)
+}
+
+// appendQuery adds parameters to the query of a URI, keeping the ones it has
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL + "?" + params.Encode()
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
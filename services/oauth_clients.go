@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthClientService registers the OAuth clients for administrators
+type OAuthClientService struct {
+	DB      *gorm.DB
+	Auditor Auditor
+}
+
+func NewOAuthClientService() *OAuthClientService {
+	return &OAuthClientService{
+		DB:      config.DB,
+		Auditor: NewAuditor(),
+	}
+}
+
+// ToOAuthClientResponse converts a model.OAuthClient to its representation in the API
+func ToOAuthClientResponse(client *model.OAuthClient) types.OAuthClientResponse {
+	return types.OAuthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		Type:         string(client.Type),
+		RedirectURIs: client.RedirectURIList(),
+		CreatedAt:    client.CreatedAt,
+		UpdatedAt:    client.UpdatedAt,
+	}
+}
+
+func (s *OAuthClientService) ListClients() ([]types.OAuthClientResponse, error) {
+	var clients []model.OAuthClient
+	if err := s.DB.Order("created_at").Find(&clients).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	responses := make([]types.OAuthClientResponse, 0, len(clients))
+	for i := range clients {
+		responses = append(responses, ToOAuthClientResponse(&clients[i]))
+	}
+	return responses, nil
+}
+
+func (s *OAuthClientService) GetClient(clientID string) (*types.OAuthClientResponse, error) {
+	client, err := findOAuthClient(s.DB, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ToOAuthClientResponse(client)
+	return &response, nil
+}
+
+// CreateClient registers a client. Confidential clients get a secret, which
+// is returned this once.
+func (s *OAuthClientService) CreateClient(actorID uint, req *types.CreateOAuthClientRequest) (*types.OAuthClientSecretResponse, error) {
+	redirectURIs, err := normalizeRedirectURIs(req.RedirectURIs)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	client := model.OAuthClient{
+		ID:           clientID,
+		Name:         req.Name,
+		Type:         model.OAuthClientType(req.Type),
+		RedirectURIs: redirectURIs,
+	}
+
+	var secret string
+	if client.Type == model.OAuthClientConfidential {
+		secret, err = utils.GenerateRandomID(32)
+		if err != nil {
+			return nil, utils.ErrInternalServer
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := s.DB.Create(&client).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminOAuthClientCreated, actorID, map[string]interface{}{
+		"client_id":     client.ID,
+		"name":          client.Name,
+		"type":          client.Type,
+		"redirect_uris": client.RedirectURIList(),
+	})
+
+	return &types.OAuthClientSecretResponse{
+		Client:       ToOAuthClientResponse(&client),
+		ClientSecret: secret,
+	}, nil
+}
+
+// UpdateClient renames a client and replaces its redirect URIs. Pending
+// authorization codes keep the redirect URI they were issued for.
+func (s *OAuthClientService) UpdateClient(actorID uint, clientID string, req *types.UpdateOAuthClientRequest) (*types.OAuthClientResponse, error) {
+	client, err := findOAuthClient(s.DB, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURIs, err := normalizeRedirectURIs(req.RedirectURIs)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Name = req.Name
+	client.RedirectURIs = redirectURIs
+	if err := s.DB.Save(client).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminOAuthClientUpdated, actorID, map[string]interface{}{
+		"client_id":     client.ID,
+		"name":          client.Name,
+		"redirect_uris": client.RedirectURIList(),
+	})
+
+	response := ToOAuthClientResponse(client)
+	return &response, nil
+}
+
+// RotateSecret replaces the secret of a confidential client, the previous one
+// stops working right away
+func (s *OAuthClientService) RotateSecret(actorID uint, clientID string) (*types.OAuthClientSecretResponse, error) {
+	client, err := findOAuthClient(s.DB, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Type != model.OAuthClientConfidential {
+		return nil, utils.ErrPublicOAuthClient
+	}
+
+	secret, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	client.SecretHash = utils.HashToken(secret)
+	if err := s.DB.Save(client).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminOAuthSecretRotated, actorID, map[string]interface{}{
+		"client_id": client.ID,
+	})
+
+	return &types.OAuthClientSecretResponse{
+		Client:       ToOAuthClientResponse(client),
+		ClientSecret: secret,
+	}, nil
+}
+
+// DeleteClient removes a client with its codes and consents, and revokes
+// every session it started
+func (s *OAuthClientService) DeleteClient(actorID uint, clientID string) error {
+	client, err := findOAuthClient(s.DB, clientID)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.RefreshTokenFamily{}).
+			Where("client_id = ? AND revoked_at IS NULL", client.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", client.ID).Delete(&model.OAuthAuthorizationCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", client.ID).Delete(&model.OAuthConsent{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(client).Error
+	})
+	if err != nil {
+		return utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminOAuthClientDeleted, actorID, map[string]interface{}{
+		"client_id": client.ID,
+		"name":      client.Name,
+	})
+	return nil
+}
+
+func findOAuthClient(db *gorm.DB, clientID string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	if err := db.First(&client, "id = ?", clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrOAuthClientNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &client, nil
+}
+
+// normalizeRedirectURIs validates the redirect URIs of a client and joins
+// them, without duplicates, for model.OAuthClient
+func normalizeRedirectURIs(redirectURIs []string) (string, error) {
+	seen := make(map[string]struct{}, len(redirectURIs))
+	unique := make([]string, 0, len(redirectURIs))
+	for _, redirectURI := range redirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return "", err
+		}
+		if _, ok := seen[redirectURI]; ok {
+			continue
+		}
+		seen[redirectURI] = struct{}{}
+		unique = append(unique, redirectURI)
+	}
+	return strings.Join(unique, " "), nil
+}
+
+// validateRedirectURI accepts absolute URIs without fragment (RFC 6749
+// section 3.1.2) that use https, http on the loopback interface, or the
+// reverse domain name scheme of a native app (RFC 8252 section 7.1)
+func validateRedirectURI(redirectURI string) error {
+	if strings.ContainsAny(redirectURI, " \t\r\n#") {
+		return utils.ErrInvalidRedirectURI
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() {
+		return utils.ErrInvalidRedirectURI
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return utils.ErrInvalidRedirectURI
+		}
+	case "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return utils.ErrInvalidRedirectURI
+		}
+	default:
+		if !strings.Contains(u.Scheme, ".") {
+			return utils.ErrInvalidRedirectURI
+		}
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"strconv"
+	"strings"
+)
+
+// Scopes of OpenID Connect. openid asks for an ID token, profile and email
+// for the matching claims.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// Scopes of the API that clients may request, named after the permissions
+// they allow the access token to use
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+)
+
+// SupportedScopes lists the scopes of the server, granted scopes are written
+// in this order
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeProfileRead, ScopeProfileWrite}
+
+// ScopesSupported returns the scopes clients may request. openid asks for ID
+// tokens, which are only issued when relying parties can verify them.
+func ScopesSupported() []string {
+	if utils.SignsIDTokens() {
+		return SupportedScopes
+	}
+
+	scopes := make([]string, 0, len(SupportedScopes))
+	for _, scope := range SupportedScopes {
+		if scope != ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// SupportedClaims lists the claims about the user that ID tokens and the
+// userinfo endpoint may return
+var SupportedClaims = []string{"sub", "name", "email", "email_verified", "nonce", "auth_time", "amr"}
+
+// maxNonceLength bounds the nonce stored with an authorization code
+const maxNonceLength = 255
+
+// UserInfo returns the claims about the user that the scope of the access
+// token's session allows. Errors are *utils.OAuthError.
+func (s *AuthService) UserInfo(accessToken *types.TokenMetadata) (*types.UserInfoResponse, error) {
+	var family model.RefreshTokenFamily
+	if accessToken.SessionID != "" {
+		if err := s.db.First(&family, "id = ?", accessToken.SessionID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+		}
+	}
+
+	if !hasScope(family.Scope, ScopeOpenID) {
+		return nil, utils.NewOAuthError(utils.OAuthInsufficientScope, "The access token was not granted the openid scope")
+	}
+
+	var user model.User
+	if err := s.db.First(&user, accessToken.UserID).Error; err != nil {
+		return nil, utils.NewOAuthError(utils.OAuthServerError, "An unexpected error occurred")
+	}
+
+	userInfo := userInfoClaims(&user, family.Scope)
+	return &userInfo, nil
+}
+
+// generateIDToken issues the ID token of a session started by an OAuth client
+func (s *AuthService) generateIDToken(family *model.RefreshTokenFamily, nonce string) (string, error) {
+	var user model.User
+	if err := s.db.First(&user, family.UserID).Error; err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	userInfo := userInfoClaims(&user, family.Scope)
+	idToken, err := utils.GenerateIDToken(&types.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  userInfo.Sub,
+			Audience: jwt.ClaimStrings{family.ClientID},
+		},
+		Nonce:         nonce,
+		AuthTime:      family.AuthTime.Unix(),
+		AMR:           strings.Fields(family.AuthMethods),
+		Name:          userInfo.Name,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+	})
+	if err != nil {
+		return "", utils.ErrTokenGeneration
+	}
+	return idToken, nil
+}
+
+// userInfoClaims returns the claims about the user that scope allows
+func userInfoClaims(user *model.User, scope string) types.UserInfoResponse {
+	userInfo := types.UserInfoResponse{
+		Sub: strconv.FormatUint(uint64(user.ID), 10),
+	}
+	if hasScope(scope, ScopeProfile) {
+		userInfo.Name = user.Name
+	}
+	if hasScope(scope, ScopeEmail) {
+		emailVerified := user.IsEmailVerified()
+		userInfo.Email = user.Email
+		userInfo.EmailVerified = &emailVerified
+	}
+	return userInfo
+}
+
+// parseScope checks the scope of an authorization request and returns the
+// requested scopes without duplicates, in the order of SupportedScopes
+func parseScope(scope string) ([]string, error) {
+	requested := make(map[string]struct{})
+	for _, value := range strings.Fields(scope) {
+		if !containsScope(ScopesSupported(), value) {
+			return nil, utils.NewOAuthError(utils.OAuthInvalidScope, "Unsupported scope "+value)
+		}
+		requested[value] = struct{}{}
+	}
+
+	scopes := make([]string, 0, len(requested))
+	for _, supported := range SupportedScopes {
+		if _, ok := requested[supported]; ok {
+			scopes = append(scopes, supported)
+		}
+	}
+	return scopes, nil
+}
+
+// mergeScopes returns the union of a space separated scope and more scopes,
+// in the order of SupportedScopes
+func mergeScopes(scope string, scopes []string) string {
+	merged := make([]string, 0, len(SupportedScopes))
+	for _, supported := range SupportedScopes {
+		if hasScope(scope, supported) || containsScope(scopes, supported) {
+			merged = append(merged, supported)
+		}
+	}
+	return strings.Join(merged, " ")
+}
+
+// coversScopes reports whether a space separated scope includes every scope of scopes
+func coversScopes(scope string, scopes []string) bool {
+	for _, want := range scopes {
+		if !hasScope(scope, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasScope reports whether a space separated scope includes want
+func hasScope(scope, want string) bool {
+	return containsScope(strings.Fields(scope), want)
+}
+
+func containsScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"jwt-auth-app/config"
+	"jwt-auth-app/utils"
+)
+
+// initTestEdDSATokens signs the tokens of the test with a fresh Ed25519 key pair
+func initTestEdDSATokens(t *testing.T) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tokenConfig := config.TokenConfig{
+		PrivateKeyPath: filepath.Join(dir, "private.pem"),
+		PublicKeyPath:  filepath.Join(dir, "public.pem"),
+		ExpirationTime: time.Hour,
+	}
+	for path, block := range map[string]*pem.Block{
+		tokenConfig.PrivateKeyPath: {Type: "PRIVATE KEY", Bytes: privateDER},
+		tokenConfig.PublicKeyPath:  {Type: "PUBLIC KEY", Bytes: publicDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config.AppConfig.JWT = config.JWTConfig{
+		Algorithm:    "EdDSA",
+		Issuer:       "https://auth.example.com",
+		AccessToken:  tokenConfig,
+		RefreshToken: tokenConfig,
+	}
+	if err := utils.InitializeJWTManager(&config.AppConfig.JWT); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		initKeys  func(t *testing.T)
+		scope     string
+		want      []string
+		supported bool
+	}{
+		{"ordered without duplicates", initTestEdDSATokens, "email openid email", []string{ScopeOpenID, ScopeEmail}, true},
+		{"openid with a key pair", initTestEdDSATokens, "openid profile", []string{ScopeOpenID, ScopeProfile}, true},
+		// Relying parties could not verify ID tokens signed with a secret
+		{"openid with a shared secret", initTestTokens, "openid profile", nil, false},
+		{"API scopes with a shared secret", initTestTokens, "profile:read profile", []string{ScopeProfile, ScopeProfileRead}, true},
+		{"unknown scope", initTestEdDSATokens, "profile admin", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.initKeys(t)
+
+			scopes, err := parseScope(tt.scope)
+			if !tt.supported {
+				var oauthErr *utils.OAuthError
+				if !errors.As(err, &oauthErr) || oauthErr.Code != utils.OAuthInvalidScope {
+					t.Fatalf("got %v, want %s", err, utils.OAuthInvalidScope)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(scopes, tt.want) {
+				t.Errorf("scopes = %v, want %v", scopes, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopesSupportedWithSharedSecret(t *testing.T) {
+	initTestTokens(t)
+
+	if containsScope(ScopesSupported(), ScopeOpenID) {
+		t.Error("openid offered with a shared secret")
+	}
+	if _, err := utils.GenerateIDToken(nil); err == nil {
+		t.Error("ID token signed with a shared secret")
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/mailer"
+	"log"
+	"net/url"
+	"time"
+)
+
+// ForgotPassword emails a password reset link to the user. Unknown, deleted
+// and deactivated accounts are silently ignored so the endpoint cannot be used
+// to find out which email addresses are registered.
+func (s *AuthService) ForgotPassword(email string) error {
+	var user model.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return utils.ErrInternalServer
+	}
+
+	if !user.IsActive {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return utils.ErrInternalServer
+	}
+
+	// Only the most recent link stays valid
+	if err := s.invalidateResetTokens(s.db, user.ID); err != nil {
+		return err
+	}
+
+	expiration := config.AppConfig.Password.ResetExpiration
+	resetToken := model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(expiration),
+	}
+	if err := s.db.Create(&resetToken).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppConfig.Server.FrontendURL, url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+			"If you did not ask for a password reset, you can ignore this email.\n", user.Name, expiration, link),
+	}
+	// Failing here would tell registered addresses apart from unknown ones
+	if err := s.mailer.Send(msg); err != nil {
+		log.Println("Failed to send password reset email:", err)
+		return nil
+	}
+
+	s.audit(model.AuditPasswordResetRequested, model.AuditSuccess, user.ID, types.ClientInfo{}, nil)
+	return nil
+}
+
+// ResetPassword sets a new password using a token sent by ForgotPassword. The
+// token can only be used once, and every session of the user is revoked.
+func (s *AuthService) ResetPassword(token, password string) error {
+	var resetToken model.PasswordResetToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&resetToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrInvalidResetToken
+		}
+		return utils.ErrInternalServer
+	}
+
+	if resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+		return utils.ErrInvalidResetToken
+	}
+
+	var user model.User
+	if err := s.db.First(&user, resetToken.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrInvalidResetToken
+		}
+		return utils.ErrInternalServer
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return err
+	}
+
+	if err := s.passwordPolicy.Validate("password", password, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return utils.ErrInternalServer
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Consuming with a conditional update keeps concurrent resets from both succeeding
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return utils.ErrInternalServer
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrInvalidResetToken
+		}
+
+		updates := map[string]interface{}{
+			"password":                hashedPassword,
+			"password_reset_required": false,
+		}
+		// Following the emailed link proves ownership of the address as well
+		if !user.IsEmailVerified() {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return utils.ErrInternalServer
+		}
+
+		return s.invalidateResetTokens(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := revokeUserTokens(s.db, s.revocations, user.ID); err != nil {
+		return err
+	}
+
+	s.audit(model.AuditPasswordReset, model.AuditSuccess, user.ID, types.ClientInfo{}, nil)
+	return nil
+}
+
+// invalidateResetTokens marks every unused reset token of the user as used
+func (s *AuthService) invalidateResetTokens(db *gorm.DB, userID uint) error {
+	if err := db.Model(&model.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"jwt-auth-app/utils/mailer"
+)
+
+const newTestPassword = "another correct horse"
+
+var resetLinkPattern = regexp.MustCompile(`/reset-password\?token=(\S+)`)
+
+// resetTokens returns the tokens of the reset links dropped into mailDir, in
+// the order they were sent
+func resetTokens(t *testing.T, mailDir string) []string {
+	t.Helper()
+
+	// Files are named after the time they were written
+	paths, err := filepath.Glob(filepath.Join(mailDir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	for _, path := range paths {
+		email, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		match := resetLinkPattern.FindSubmatch(email)
+		if match == nil {
+			t.Fatalf("no reset link in %s", path)
+		}
+		token, err := url.QueryUnescape(string(match[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func requestResetToken(t *testing.T, svc *AuthService, mailDir, email string) string {
+	t.Helper()
+
+	if err := svc.ForgotPassword(email); err != nil {
+		t.Fatal(err)
+	}
+	tokens := resetTokens(t, mailDir)
+	if len(tokens) == 0 {
+		t.Fatal("no reset email sent")
+	}
+	return tokens[len(tokens)-1]
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	svc, mailDir := newTestAuthService(t)
+	createTestUser(t, svc, "reset@example.com")
+	before := login(t, svc, "reset@example.com")
+	token := requestResetToken(t, svc, mailDir, "reset@example.com")
+
+	if err := svc.ResetPassword(token, newTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ResetPassword(token, "yet another password"); !errors.Is(err, utils.ErrInvalidResetToken) {
+		t.Errorf("second reset: got %v, want %v", err, utils.ErrInvalidResetToken)
+	}
+
+	// The reset ends the sessions started before it
+	if err := validateAccessToken(t, svc, before.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token from before the reset: got %v, want %v", err, utils.ErrTokenRevoked)
+	}
+
+	// and the new password works right away
+	response, err := svc.Login(&types.LoginRequest{Email: "reset@example.com", Password: newTestPassword}, types.ClientInfo{})
+	if err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	if err := validateAccessToken(t, svc, response.Token.AccessToken); err != nil {
+		t.Errorf("access token issued after the reset: %v", err)
+	}
+}
+
+func TestResetPasswordTokenExpires(t *testing.T) {
+	svc, mailDir := newTestAuthService(t)
+	user := createTestUser(t, svc, "expired@example.com")
+	token := requestResetToken(t, svc, mailDir, "expired@example.com")
+
+	if err := svc.db.Model(&model.PasswordResetToken{}).
+		Where("user_id = ?", user.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.ResetPassword(token, newTestPassword); !errors.Is(err, utils.ErrInvalidResetToken) {
+		t.Errorf("expired token: got %v, want %v", err, utils.ErrInvalidResetToken)
+	}
+	login(t, svc, "expired@example.com")
+}
+
+func TestForgotPasswordInvalidatesEarlierLinks(t *testing.T) {
+	svc, mailDir := newTestAuthService(t)
+	createTestUser(t, svc, "twice@example.com")
+	first := requestResetToken(t, svc, mailDir, "twice@example.com")
+	second := requestResetToken(t, svc, mailDir, "twice@example.com")
+
+	if err := svc.ResetPassword(first, newTestPassword); !errors.Is(err, utils.ErrInvalidResetToken) {
+		t.Errorf("earlier link: got %v, want %v", err, utils.ErrInvalidResetToken)
+	}
+	if err := svc.ResetPassword(second, newTestPassword); err != nil {
+		t.Errorf("latest link: %v", err)
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	svc, mailDir := newTestAuthService(t)
+
+	if err := svc.ForgotPassword("nobody@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := resetTokens(t, mailDir); len(tokens) != 0 {
+		t.Errorf("sent %d emails to an unknown address", len(tokens))
+	}
+}
+
+// failingMailer stands in for an SMTP relay that is down
+type failingMailer struct{}
+
+func (failingMailer) Send(mailer.Message) error {
+	return errors.New("relay unavailable")
+}
+
+func TestForgotPasswordMailerFailure(t *testing.T) {
+	svc, _ := newTestAuthService(t)
+	createTestUser(t, svc, "registered@example.com")
+	svc.mailer = failingMailer{}
+
+	// A failing relay must not tell registered addresses apart
+	for _, email := range []string{"registered@example.com", "nobody@example.com"} {
+		if err := svc.ForgotPassword(email); err != nil {
+			t.Errorf("%s: %v", email, err)
+		}
+	}
+}
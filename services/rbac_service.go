@@ -0,0 +1,322 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"sort"
+	"strings"
+)
+
+type RBACService struct {
+	DB *gorm.DB
+}
+
+func NewRBACService() *RBACService {
+	return &RBACService{DB: config.DB}
+}
+
+// GetUserPermissions resolves the permissions granted to a user through the
+// built-in role matching users.role and every role assigned in user_roles
+func (s *RBACService) GetUserPermissions(userID uint) ([]string, error) {
+	var user model.User
+	if err := s.DB.Select("id", "role").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	assignedRoles := s.DB.Model(&model.UserRoleAssignment{}).Select("role_id").Where("user_id = ?", userID)
+
+	var permissions []string
+	if err := s.DB.Model(&model.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ? OR roles.id IN (?)", string(user.Role), assignedRoles).
+		Order("permissions.name").
+		Pluck("permissions.name", &permissions).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return permissions, nil
+}
+
+// GetRolePermissions resolves the permissions granted to a role, as held by
+// the service accounts given that role
+func (s *RBACService) GetRolePermissions(roleName string) ([]string, error) {
+	var permissions []string
+	if err := s.DB.Model(&model.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", roleName).
+		Order("permissions.name").
+		Pluck("permissions.name", &permissions).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return permissions, nil
+}
+
+func (s *RBACService) ListRoles() ([]types.RoleResponse, error) {
+	var roles []model.Role
+	if err := s.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	responses := make([]types.RoleResponse, 0, len(roles))
+	for i := range roles {
+		responses = append(responses, toRoleResponse(&roles[i]))
+	}
+	return responses, nil
+}
+
+func (s *RBACService) GetRole(roleID uint) (*types.RoleResponse, error) {
+	role, err := s.getRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := toRoleResponse(role)
+	return &response, nil
+}
+
+func (s *RBACService) CreateRole(req *types.CreateRoleRequest) (*types.RoleResponse, error) {
+	var existing model.Role
+	if err := s.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		return nil, utils.ErrRoleExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrInternalServer
+	}
+
+	role := model.Role{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := s.DB.Create(&role).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	response := toRoleResponse(&role)
+	return &response, nil
+}
+
+func (s *RBACService) DeleteRole(roleID uint) error {
+	role, err := s.getRole(roleID)
+	if err != nil {
+		return err
+	}
+
+	if role.IsBuiltIn() {
+		return utils.ErrRoleProtected
+	}
+
+	if err := s.DB.Select("Permissions").Delete(role).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	if err := s.DB.Where("role_id = ?", role.ID).Delete(&model.UserRoleAssignment{}).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
+
+func (s *RBACService) ListPermissions() ([]types.PermissionResponse, error) {
+	var permissions []model.Permission
+	if err := s.DB.Order("name").Find(&permissions).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	responses := make([]types.PermissionResponse, 0, len(permissions))
+	for i := range permissions {
+		responses = append(responses, toPermissionResponse(&permissions[i]))
+	}
+	return responses, nil
+}
+
+func (s *RBACService) CreatePermission(req *types.CreatePermissionRequest) (*types.PermissionResponse, error) {
+	resource, action, ok := strings.Cut(req.Name, ":")
+	if !ok || resource == "" || action == "" {
+		return nil, utils.ErrInvalidPermission
+	}
+
+	var existing model.Permission
+	if err := s.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		return nil, utils.ErrPermissionExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrInternalServer
+	}
+
+	permission := model.Permission{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := s.DB.Create(&permission).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	response := toPermissionResponse(&permission)
+	return &response, nil
+}
+
+func (s *RBACService) DeletePermission(permissionID uint) error {
+	permission, err := s.getPermission(permissionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.DB.Exec("DELETE FROM role_permissions WHERE permission_id = ?", permission.ID).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	if err := s.DB.Delete(permission).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
+
+// GrantPermission adds a permission to a role
+func (s *RBACService) GrantPermission(roleID, permissionID uint) (*types.RoleResponse, error) {
+	role, err := s.getRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	permission, err := s.getPermission(permissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(role).Association("Permissions").Append(permission); err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return s.GetRole(role.ID)
+}
+
+// RevokePermission removes a permission from a role
+func (s *RBACService) RevokePermission(roleID, permissionID uint) (*types.RoleResponse, error) {
+	role, err := s.getRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	permission, err := s.getPermission(permissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(role).Association("Permissions").Delete(permission); err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return s.GetRole(role.ID)
+}
+
+// GetUserRoles lists the roles assigned to a user in addition to the built-in one
+func (s *RBACService) GetUserRoles(userID uint) ([]types.RoleResponse, error) {
+	if err := s.userExists(userID); err != nil {
+		return nil, err
+	}
+
+	var roles []model.Role
+	if err := s.DB.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.id").
+		Find(&roles).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	responses := make([]types.RoleResponse, 0, len(roles))
+	for i := range roles {
+		responses = append(responses, toRoleResponse(&roles[i]))
+	}
+	return responses, nil
+}
+
+func (s *RBACService) AssignRole(userID, roleID uint) error {
+	if err := s.userExists(userID); err != nil {
+		return err
+	}
+
+	if _, err := s.getRole(roleID); err != nil {
+		return err
+	}
+
+	assignment := model.UserRoleAssignment{UserID: userID, RoleID: roleID}
+	if err := s.DB.Where(&assignment).FirstOrCreate(&assignment).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
+
+func (s *RBACService) UnassignRole(userID, roleID uint) error {
+	if err := s.userExists(userID); err != nil {
+		return err
+	}
+
+	if err := s.DB.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&model.UserRoleAssignment{}).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
+
+func (s *RBACService) getRole(roleID uint) (*model.Role, error) {
+	var role model.Role
+	if err := s.DB.Preload("Permissions").First(&role, roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRoleNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &role, nil
+}
+
+func (s *RBACService) getPermission(permissionID uint) (*model.Permission, error) {
+	var permission model.Permission
+	if err := s.DB.First(&permission, permissionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrPermissionNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &permission, nil
+}
+
+func (s *RBACService) userExists(userID uint) error {
+	var count int64
+	if err := s.DB.Model(&model.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	if count == 0 {
+		return utils.ErrUserNotFound
+	}
+	return nil
+}
+
+func toRoleResponse(role *model.Role) types.RoleResponse {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission.Name)
+	}
+	sort.Strings(permissions)
+
+	return types.RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: permissions,
+	}
+}
+
+func toPermissionResponse(permission *model.Permission) types.PermissionResponse {
+	return types.PermissionResponse{
+		ID:          permission.ID,
+		Name:        permission.Name,
+		Description: permission.Description,
+	}
+}
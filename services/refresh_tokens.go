@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"strings"
+	"time"
+)
+
+// Authentication method references of RFC 8176, recorded on sessions and
+// returned in the amr claim of ID tokens
+const (
+	authMethodPassword = "pwd"
+	authMethodOTP      = "otp"
+	authMethodMFA      = "mfa"
+	// authMethodHardwareKey and authMethodSoftwareKey are passkeys bound to
+	// a device or synced between devices
+	authMethodHardwareKey = "hwk"
+	authMethodSoftwareKey = "swk"
+)
+
+// sessionOptions describes how a session was started
+type sessionOptions struct {
+	// AuthMethods and AuthTime describe how and when the user authenticated,
+	// AuthTime defaults to now
+	AuthMethods []string
+	AuthTime    time.Time
+	// OAuthClientID is the OAuth client that started the session, which can
+	// only be refreshed by that client, and Scope what the user granted it
+	OAuthClientID string
+	Scope         string
+}
+
+// issueTokens starts a new session, a refresh token family, for the user who
+// just authenticated with authMethods on the client and issues its first
+// token pair
+func (s *AuthService) issueTokens(user *model.User, client types.ClientInfo, authMethods ...string) (*types.TokenPair, error) {
+	return s.startSession(user, client, sessionOptions{AuthMethods: authMethods})
+}
+
+// startSession starts a new session like issueTokens, described by opts
+func (s *AuthService) startSession(user *model.User, client types.ClientInfo, opts sessionOptions) (*types.TokenPair, error) {
+	familyID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, utils.ErrTokenGeneration
+	}
+
+	now := time.Now()
+	authTime := opts.AuthTime
+	if authTime.IsZero() {
+		authTime = now
+	}
+
+	family := model.RefreshTokenFamily{
+		ID:          familyID,
+		UserID:      user.ID,
+		UserAgent:   client.UserAgent,
+		IPAddress:   client.IPAddress,
+		DeviceName:  utils.DeviceName(client.UserAgent),
+		ClientID:    opts.OAuthClientID,
+		Scope:       opts.Scope,
+		AuthMethods: strings.Join(opts.AuthMethods, " "),
+		AuthTime:    authTime,
+		LastUsedAt:  now,
+	}
+	if err := s.db.Create(&family).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return s.issueFamilyTokens(user, &family)
+}
+
+// issueFamilyTokens issues a token pair within an existing family and records the refresh token
+func (s *AuthService) issueFamilyTokens(user *model.User, family *model.RefreshTokenFamily) (*types.TokenPair, error) {
+	scopes, err := s.sessionScopes(user, family)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := utils.GenerateTokenPair(types.TokenSubject{
+		UserID:        user.ID,
+		Role:          string(user.Role),
+		FamilyID:      family.ID,
+		EmailVerified: user.IsEmailVerified(),
+		ClientID:      family.ClientID,
+		Scopes:        scopes,
+	})
+	if err != nil {
+		return nil, utils.ErrTokenGeneration
+	}
+
+	refreshToken := model.RefreshToken{
+		JTI:       tokens.RefreshTokenMetadata.TokenID,
+		FamilyID:  family.ID,
+		UserID:    user.ID,
+		ExpiresAt: time.Unix(tokens.RefreshTokenMetadata.ExpiresAt, 0),
+	}
+	if err := s.db.Create(&refreshToken).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return tokens, nil
+}
+
+// rotateRefreshToken consumes the presented refresh token and issues the next
+// pair of its family. Presenting a token that was already consumed means it
+// leaked, so the whole family is revoked. The family must have been started
+// through the OAuth client given by its id, or through this API's own login
+// when it is empty.
+func (s *AuthService) rotateRefreshToken(user *model.User, metadata *types.TokenMetadata, oauthClientID string, client types.ClientInfo) (*types.TokenPair, error) {
+	var family model.RefreshTokenFamily
+	if err := s.db.First(&family, "id = ? AND user_id = ?", metadata.FamilyID, metadata.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidRefreshToken
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	if family.ClientID != oauthClientID {
+		return nil, utils.ErrInvalidRefreshToken
+	}
+
+	if family.RevokedAt != nil {
+		return nil, utils.ErrTokenRevoked
+	}
+
+	// Consuming with a conditional update keeps concurrent refreshes from both succeeding
+	result := s.db.Model(&model.RefreshToken{}).
+		Where("jti = ? AND family_id = ? AND consumed_at IS NULL", metadata.TokenID, family.ID).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := s.db.Model(&model.RefreshToken{}).Where("jti = ? AND family_id = ?", metadata.TokenID, family.ID).Count(&count).Error; err != nil {
+			return nil, utils.ErrInternalServer
+		}
+		if count == 0 {
+			return nil, utils.ErrInvalidRefreshToken
+		}
+
+		if err := s.revokeFamily(family.ID); err != nil {
+			return nil, err
+		}
+		s.audit(model.AuditRefreshTokenReused, model.AuditFailure, user.ID, client, map[string]interface{}{
+			"session_id": family.ID,
+		})
+		return nil, utils.ErrRefreshTokenReused
+	}
+
+	// The session follows the client, its address changes when it moves networks
+	if err := s.db.Model(&family).Updates(map[string]interface{}{
+		"user_agent":   client.UserAgent,
+		"ip_address":   client.IPAddress,
+		"device_name":  utils.DeviceName(client.UserAgent),
+		"last_used_at": time.Now(),
+	}).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return s.issueFamilyTokens(user, &family)
+}
+
+// sessionScopes returns the scopes of the access tokens of a session. Sessions
+// of OAuth clients get the scopes the user granted, the sessions of this API's
+// own login every permission the user holds when the token is issued.
+func (s *AuthService) sessionScopes(user *model.User, family *model.RefreshTokenFamily) ([]string, error) {
+	if family.ClientID != "" {
+		return strings.Fields(family.Scope), nil
+	}
+	return s.rbac.GetUserPermissions(user.ID)
+}
+
+// revokeFamily revokes every refresh token that descends from the same login
+func (s *AuthService) revokeFamily(familyID string) error {
+	if err := s.db.Model(&model.RefreshTokenFamily{}).
+		Where("id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
+
+// revokeUserTokens revokes every access and refresh token issued to the user so far
+func revokeUserTokens(db *gorm.DB, revocations RevocationStore, userID uint) error {
+	now := time.Now()
+	if err := revocations.RevokeAllForUser(userID, now); err != nil {
+		return utils.ErrInternalServer
+	}
+
+	if err := db.Model(&model.RefreshTokenFamily{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	return nil
+}
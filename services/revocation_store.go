@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"sync"
+	"time"
+)
+
+// RevocationStore keeps track of tokens that must no longer be accepted even
+// though their signature and expiry are still valid
+type RevocationStore interface {
+	// Revoke revokes a single token by its jti
+	Revoke(metadata *types.TokenMetadata) error
+	// RevokeAllForUser revokes every token of the user issued before the given time
+	RevokeAllForUser(userID uint, before time.Time) error
+	// IsRevoked reports whether the token was revoked individually or as part of its user
+	IsRevoked(metadata *types.TokenMetadata) (bool, error)
+}
+
+// issuedBefore reports whether a token was issued before the cutoff. iat has a
+// resolution of one second, so the cutoff is rounded down to it and tokens
+// issued within its second stay valid, a login right after a password reset
+// must work. The sessions revoked along with the cutoff refuse the tokens
+// issued earlier in that second.
+func issuedBefore(metadata *types.TokenMetadata, cutoff time.Time) bool {
+	return metadata.IssuedAt < cutoff.Unix()
+}
+
+// GormRevocationStore persists revocations in Postgres
+type GormRevocationStore struct {
+	db *gorm.DB
+}
+
+func NewGormRevocationStore(db *gorm.DB) *GormRevocationStore {
+	return &GormRevocationStore{db: db}
+}
+
+func (s *GormRevocationStore) Revoke(metadata *types.TokenMetadata) error {
+	// Revoked tokens that expired on their own are cleaned up along the way
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&model.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	revoked := model.RevokedToken{
+		JTI:       metadata.TokenID,
+		UserID:    metadata.UserID,
+		TokenType: string(metadata.TokenType),
+		ExpiresAt: time.Unix(metadata.ExpiresAt, 0),
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error
+}
+
+func (s *GormRevocationStore) RevokeAllForUser(userID uint, before time.Time) error {
+	revocation := model.UserTokenRevocation{
+		UserID:        userID,
+		RevokedBefore: before,
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before"}),
+	}).Create(&revocation).Error
+}
+
+func (s *GormRevocationStore) IsRevoked(metadata *types.TokenMetadata) (bool, error) {
+	var count int64
+	if err := s.db.Model(&model.RevokedToken{}).Where("jti = ?", metadata.TokenID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	var revocation model.UserTokenRevocation
+	if err := s.db.First(&revocation, metadata.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return issuedBefore(metadata, revocation.RevokedBefore), nil
+}
+
+// MemoryRevocationStore keeps revocations in memory, it is meant for tests and
+// single instance development setups
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	tokens  map[string]time.Time // jti -> expiry
+	cutoffs map[uint]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:  make(map[string]time.Time),
+		cutoffs: make(map[uint]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(metadata *types.TokenMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop entries that expired on their own while we hold the lock anyway
+	now := time.Now()
+	for jti, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, jti)
+		}
+	}
+
+	s.tokens[metadata.TokenID] = time.Unix(metadata.ExpiresAt, 0)
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeAllForUser(userID uint, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cutoffs[userID] = before
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(metadata *types.TokenMetadata) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[metadata.TokenID]; ok {
+		return true, nil
+	}
+
+	cutoff, ok := s.cutoffs[metadata.UserID]
+	return ok && issuedBefore(metadata, cutoff), nil
+}
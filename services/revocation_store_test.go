@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+)
+
+func TestMemoryRevocationStoreRevoke(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	revoked := &types.TokenMetadata{TokenID: "revoked", UserID: 1, ExpiresAt: expiresAt}
+	other := &types.TokenMetadata{TokenID: "other", UserID: 1, ExpiresAt: expiresAt}
+
+	if err := store.Revoke(revoked); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := store.IsRevoked(revoked); !ok {
+		t.Error("revoked token is accepted")
+	}
+	if ok, _ := store.IsRevoked(other); ok {
+		t.Error("token with another jti is refused")
+	}
+}
+
+func TestGormRevocationStoreRevokeDeletesExpired(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormRevocationStore(db)
+	expired := &types.TokenMetadata{TokenID: "expired", UserID: 1, ExpiresAt: time.Now().Add(-time.Minute).Unix()}
+	revoked := &types.TokenMetadata{TokenID: "revoked", UserID: 1, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	if err := store.Revoke(expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(revoked); err != nil {
+		t.Fatal(err)
+	}
+
+	var jtis []string
+	if err := db.Model(&model.RevokedToken{}).Pluck("jti", &jtis).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jtis) != 1 || jtis[0] != "revoked" {
+		t.Errorf("revoked tokens = %v, want [revoked]", jtis)
+	}
+}
+
+func TestMemoryRevocationStoreRevokeAllForUser(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	cutoff := time.Unix(1_700_000_000, 500_000_000)
+	if err := store.RevokeAllForUser(1, cutoff); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   uint
+		issuedAt int64
+		revoked  bool
+	}{
+		{"issued a second before", 1, cutoff.Unix() - 1, true},
+		// iat has no fraction, the tokens of a login right after the cutoff
+		// share its second
+		{"issued within the same second", 1, cutoff.Unix(), false},
+		{"issued after", 1, cutoff.Unix() + 1, false},
+		{"another user", 2, cutoff.Unix() - 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &types.TokenMetadata{TokenID: tt.name, UserID: tt.userID, IssuedAt: tt.issuedAt}
+			revoked, err := store.IsRevoked(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	svc, _ := newTestAuthService(t)
+	createTestUser(t, svc, "logout@example.com")
+	tokens := login(t, svc, "logout@example.com")
+	other := login(t, svc, "logout@example.com")
+
+	metadata, err := utils.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Logout(metadata, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := svc.revocations.IsRevoked(metadata); !ok {
+		t.Error("the jti of the access token is not revoked")
+	}
+	if err := validateAccessToken(t, svc, tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token after logout: got %v, want %v", err, utils.ErrTokenRevoked)
+	}
+	if _, err := svc.RefreshToken(tokens.RefreshToken, types.ClientInfo{}); err == nil {
+		t.Error("refresh token after logout is accepted")
+	}
+
+	// Other sessions are not affected
+	if err := validateAccessToken(t, svc, other.AccessToken); err != nil {
+		t.Errorf("access token of another session: %v", err)
+	}
+}
+
+func TestLogoutAllRevokesEarlierTokens(t *testing.T) {
+	svc, _ := newTestAuthService(t)
+	user := createTestUser(t, svc, "logout-all@example.com")
+	first := login(t, svc, "logout-all@example.com")
+	second := login(t, svc, "logout-all@example.com")
+
+	if err := svc.LogoutAll(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tokens := range map[string]*types.TokenPair{"first": first, "second": second} {
+		if err := validateAccessToken(t, svc, tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+			t.Errorf("%s access token: got %v, want %v", name, err, utils.ErrTokenRevoked)
+		}
+		if _, err := svc.RefreshToken(tokens.RefreshToken, types.ClientInfo{}); err == nil {
+			t.Errorf("%s refresh token is accepted", name)
+		}
+	}
+
+	// Logging in again right away, most likely within the second of the
+	// cutoff, starts a session that works
+	fresh := login(t, svc, "logout-all@example.com")
+	if err := validateAccessToken(t, svc, fresh.AccessToken); err != nil {
+		t.Errorf("access token issued after logout-all: %v", err)
+	}
+	if _, err := svc.RefreshToken(fresh.RefreshToken, types.ClientInfo{}); err != nil {
+		t.Errorf("refresh token issued after logout-all: %v", err)
+	}
+}
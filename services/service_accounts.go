@@ -0,0 +1,274 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+)
+
+// Client authentication methods of service accounts, as named by the
+// discovery document
+const (
+	AuthMethodClientSecret  = "client_secret"
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+)
+
+// ServiceAccountService manages the service accounts for administrators and
+// resolves the service accounts of access tokens
+type ServiceAccountService struct {
+	DB          *gorm.DB
+	Revocations RevocationStore
+	Auditor     Auditor
+}
+
+func NewServiceAccountService() *ServiceAccountService {
+	return &ServiceAccountService{
+		DB:          config.DB,
+		Revocations: NewGormRevocationStore(config.DB),
+		Auditor:     NewAuditor(),
+	}
+}
+
+// ToServiceAccountResponse converts a model.ServiceAccount to its representation in the API
+func ToServiceAccountResponse(account *model.ServiceAccount) types.ServiceAccountResponse {
+	authMethod := AuthMethodClientSecret
+	if account.UsesKey() {
+		authMethod = AuthMethodPrivateKeyJWT
+	}
+
+	return types.ServiceAccountResponse{
+		ClientID:   account.ID,
+		Name:       account.Name,
+		Role:       account.Role,
+		AuthMethod: authMethod,
+		IsActive:   account.IsActive,
+		LastUsedAt: account.LastUsedAt,
+		CreatedAt:  account.CreatedAt,
+		UpdatedAt:  account.UpdatedAt,
+	}
+}
+
+func (s *ServiceAccountService) ListServiceAccounts() ([]types.ServiceAccountResponse, error) {
+	var accounts []model.ServiceAccount
+	if err := s.DB.Order("created_at").Find(&accounts).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	responses := make([]types.ServiceAccountResponse, 0, len(accounts))
+	for i := range accounts {
+		responses = append(responses, ToServiceAccountResponse(&accounts[i]))
+	}
+	return responses, nil
+}
+
+func (s *ServiceAccountService) GetServiceAccount(accountID string) (*types.ServiceAccountResponse, error) {
+	account, err := findServiceAccount(s.DB, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ToServiceAccountResponse(account)
+	return &response, nil
+}
+
+// CreateServiceAccount registers a service account. Without a public key it
+// gets a secret, which is returned this once.
+func (s *ServiceAccountService) CreateServiceAccount(actorID uint, req *types.CreateServiceAccountRequest) (*types.ServiceAccountSecretResponse, error) {
+	if err := s.checkRole(req.Role); err != nil {
+		return nil, err
+	}
+	if req.PublicKey != "" {
+		if _, err := utils.ParseClientPublicKey(req.PublicKey); err != nil {
+			return nil, utils.ErrInvalidPublicKey
+		}
+	}
+
+	accountID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	account := model.ServiceAccount{
+		ID:        accountID,
+		Name:      req.Name,
+		Role:      req.Role,
+		PublicKey: req.PublicKey,
+		IsActive:  true,
+	}
+
+	var secret string
+	if !account.UsesKey() {
+		secret, err = utils.GenerateRandomID(32)
+		if err != nil {
+			return nil, utils.ErrInternalServer
+		}
+		account.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := s.DB.Create(&account).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	response := ToServiceAccountResponse(&account)
+	s.audit(model.AuditAdminServiceCreated, actorID, map[string]interface{}{
+		"service_account_id": account.ID,
+		"name":               account.Name,
+		"role":               account.Role,
+		"auth_method":        response.AuthMethod,
+	})
+
+	return &types.ServiceAccountSecretResponse{
+		ServiceAccount: response,
+		ClientSecret:   secret,
+	}, nil
+}
+
+// UpdateServiceAccount renames a service account, changes its role, enables
+// or disables it and replaces its public key. Disabling it refuses its
+// access tokens right away.
+func (s *ServiceAccountService) UpdateServiceAccount(actorID uint, accountID string, req *types.UpdateServiceAccountRequest) (*types.ServiceAccountResponse, error) {
+	account, err := findServiceAccount(s.DB, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRole(req.Role); err != nil {
+		return nil, err
+	}
+
+	keyReplaced := req.PublicKey != "" && req.PublicKey != account.PublicKey
+	if keyReplaced {
+		if !account.UsesKey() {
+			return nil, utils.ErrAuthMethodMismatch
+		}
+		if _, err := utils.ParseClientPublicKey(req.PublicKey); err != nil {
+			return nil, utils.ErrInvalidPublicKey
+		}
+		account.PublicKey = req.PublicKey
+	}
+
+	account.Name = req.Name
+	account.Role = req.Role
+	account.IsActive = *req.IsActive
+	if err := s.DB.Save(account).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminServiceUpdated, actorID, map[string]interface{}{
+		"service_account_id": account.ID,
+		"name":               account.Name,
+		"role":               account.Role,
+		"is_active":          account.IsActive,
+		"key_replaced":       keyReplaced,
+	})
+
+	response := ToServiceAccountResponse(account)
+	return &response, nil
+}
+
+// RotateSecret replaces the secret of a service account, the previous one
+// stops working right away. Access tokens already issued stay valid until
+// they expire.
+func (s *ServiceAccountService) RotateSecret(actorID uint, accountID string) (*types.ServiceAccountSecretResponse, error) {
+	account, err := findServiceAccount(s.DB, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.UsesKey() {
+		return nil, utils.ErrAuthMethodMismatch
+	}
+
+	secret, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	account.SecretHash = utils.HashToken(secret)
+	if err := s.DB.Save(account).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminServiceSecretReset, actorID, map[string]interface{}{
+		"service_account_id": account.ID,
+	})
+
+	return &types.ServiceAccountSecretResponse{
+		ServiceAccount: ToServiceAccountResponse(account),
+		ClientSecret:   secret,
+	}, nil
+}
+
+// DeleteServiceAccount removes a service account, its access tokens are refused from then on
+func (s *ServiceAccountService) DeleteServiceAccount(actorID uint, accountID string) error {
+	account, err := findServiceAccount(s.DB, accountID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.DB.Delete(account).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditAdminServiceDeleted, actorID, map[string]interface{}{
+		"service_account_id": account.ID,
+		"name":               account.Name,
+	})
+	return nil
+}
+
+// GetTokenServiceAccount returns the service account of a validated access
+// token. Tokens of deleted accounts are refused as revoked.
+func (s *ServiceAccountService) GetTokenServiceAccount(tokenMetadata *types.TokenMetadata) (*types.AuthenticatedServiceAccount, error) {
+	revoked, err := s.Revocations.IsRevoked(tokenMetadata)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	if revoked {
+		return nil, utils.ErrTokenRevoked
+	}
+
+	account, err := findServiceAccount(s.DB, tokenMetadata.ServiceAccountID)
+	if errors.Is(err, utils.ErrServiceAccountNotFound) {
+		return nil, utils.ErrTokenRevoked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !account.IsActive {
+		return nil, utils.ErrAccountDisabled
+	}
+
+	return &types.AuthenticatedServiceAccount{
+		ID:   account.ID,
+		Name: account.Name,
+		Role: account.Role,
+	}, nil
+}
+
+// checkRole makes sure the role given to a service account exists
+func (s *ServiceAccountService) checkRole(name string) error {
+	var count int64
+	if err := s.DB.Model(&model.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+	if count == 0 {
+		return utils.ErrRoleNotFound
+	}
+	return nil
+}
+
+func findServiceAccount(db *gorm.DB, accountID string) (*model.ServiceAccount, error) {
+	var account model.ServiceAccount
+	if err := db.First(&account, "id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrServiceAccountNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+	return &account, nil
+}
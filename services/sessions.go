@@ -0,0 +1,71 @@
+package services
+
+import (
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"time"
+)
+
+// ListSessions lists the sessions of the user that can still be refreshed,
+// most recently used first. currentSessionID marks the session of the caller.
+func (s *AuthService) ListSessions(userID uint, currentSessionID string) ([]types.SessionResponse, error) {
+	families := []model.RefreshTokenFamily{}
+	if err := s.db.
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = refresh_token_families.id AND refresh_tokens.consumed_at IS NULL AND refresh_tokens.expires_at > ?)", time.Now()).
+		Order("last_used_at DESC").
+		Find(&families).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	sessions := make([]types.SessionResponse, 0, len(families))
+	for _, family := range families {
+		sessions = append(sessions, types.SessionResponse{
+			ID:         family.ID,
+			DeviceName: family.DeviceName,
+			UserAgent:  family.UserAgent,
+			IPAddress:  family.IPAddress,
+			ClientID:   family.ClientID,
+			CreatedAt:  family.CreatedAt,
+			LastUsedAt: family.LastUsedAt,
+			Current:    family.ID == currentSessionID,
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession logs the user out of one of their sessions. Its refresh
+// tokens and access tokens stop working right away.
+func (s *AuthService) RevokeSession(userID uint, sessionID string) error {
+	result := s.db.Model(&model.RefreshTokenFamily{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return utils.ErrInternalServer
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrSessionNotFound
+	}
+
+	s.audit(model.AuditSessionRevoked, model.AuditSuccess, userID, types.ClientInfo{}, map[string]interface{}{
+		"session_id": sessionID,
+	})
+	return nil
+}
+
+// isSessionRevoked reports whether the session an access token belongs to was
+// revoked. Tokens issued before sessions were tracked carry no session.
+func (s *UsersService) isSessionRevoked(metadata *types.TokenMetadata) (bool, error) {
+	if metadata.SessionID == "" {
+		return false, nil
+	}
+
+	var count int64
+	if err := s.DB.Model(&model.RefreshTokenFamily{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", metadata.SessionID, metadata.UserID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
@@ -10,11 +10,19 @@ import (
 )
 
 type UsersService struct {
-	DB *gorm.DB
+	DB            *gorm.DB
+	Revocations   RevocationStore
+	LoginAttempts LoginAttemptStore
+	Auditor       Auditor
 }
 
 func NewUsersService() *UsersService {
-	return &UsersService{DB: config.DB}
+	return &UsersService{
+		DB:            config.DB,
+		Revocations:   NewGormRevocationStore(config.DB),
+		LoginAttempts: newLoginAttemptStore(config.DB),
+		Auditor:       NewAuditor(),
+	}
 }
 
 // GetUserByID retrieves a user by their ID
@@ -29,31 +37,80 @@ func (s *UsersService) GetUserByID(userID uint) (*model.User, error) {
 	return &user, nil
 }
 
+// ToUserResponse converts a model.User to the user representation of the API
+func ToUserResponse(user *model.User) types.UserResponse {
+	response := types.UserResponse{
+		ID:                    user.ID,
+		Email:                 user.Email,
+		Name:                  user.Name,
+		Role:                  string(user.Role),
+		IsActive:              user.IsActive,
+		PasswordResetRequired: user.PasswordResetRequired,
+		EmailVerifiedAt:       user.EmailVerifiedAt,
+		CreatedAt:             user.CreatedAt,
+	}
+	if user.DeletedAt.Valid {
+		response.DeletedAt = &user.DeletedAt.Time
+	}
+	return response
+}
+
+// checkAccountStatus refuses accounts that were deleted or deactivated
+func checkAccountStatus(user *model.User) error {
+	if user.DeletedAt.Valid {
+		return utils.ErrAccountDeleted
+	}
+	if !user.IsActive {
+		return utils.ErrAccountDisabled
+	}
+	return nil
+}
+
 // GetAuthenticatedUser converts a model.User to types.AuthenticatedUser
 func (s *UsersService) GetAuthenticatedUser(user *model.User) *types.AuthenticatedUser {
 	return &types.AuthenticatedUser{
 		ID:    user.ID,
 		Email: user.Email,
 		Name:  user.Name,
+		Role:  string(user.Role),
 	}
 }
 
-// ValidateAndGetUser validates the token and returns the user
-func (s *UsersService) ValidateAndGetUser(token string) (*types.AuthenticatedUser, *types.TokenMetadata, error) {
-	// Validate token
-	tokenMetadata, err := utils.ValidateAccessToken(token)
+// GetTokenUser returns the user of a validated access token, refusing the
+// tokens of deactivated or deleted accounts and the revoked ones
+func (s *UsersService) GetTokenUser(tokenMetadata *types.TokenMetadata) (*types.AuthenticatedUser, error) {
+	// Get user from database, including deleted ones so they get a distinct error
+	var user model.User
+	if err := s.DB.Unscoped().First(&user, tokenMetadata.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	if err := checkAccountStatus(&user); err != nil {
+		return nil, err
+	}
+
+	// Reject tokens revoked by logout
+	revoked, err := s.Revocations.IsRevoked(tokenMetadata)
 	if err != nil {
-		return nil, nil, utils.ErrInvalidToken
+		return nil, utils.ErrInternalServer
+	}
+	if revoked {
+		return nil, utils.ErrTokenRevoked
 	}
 
-	// Get user from database
-	user, err := s.GetUserByID(tokenMetadata.UserID)
+	// Reject tokens of sessions the user logged out of
+	revoked, err = s.isSessionRevoked(tokenMetadata)
 	if err != nil {
-		return nil, nil, err
+		return nil, utils.ErrInternalServer
+	}
+	if revoked {
+		return nil, utils.ErrTokenRevoked
 	}
 
-	authenticatedUser := s.GetAuthenticatedUser(user)
-	return authenticatedUser, tokenMetadata, nil
+	return s.GetAuthenticatedUser(&user), nil
 }
 
 func (s *UsersService) UpdateProfile(userID uint, req *types.UpdateProfileRequest) (*types.UserResponse, error) {
@@ -63,8 +120,10 @@ func (s *UsersService) UpdateProfile(userID uint, req *types.UpdateProfileReques
 	}
 
 	// Update only the fields that are provided
-	if req.Name != "" {
+	changed := []string{}
+	if req.Name != "" && req.Name != user.Name {
 		user.Name = req.Name
+		changed = append(changed, "name")
 	}
 	// Add more fields as needed
 
@@ -72,9 +131,31 @@ func (s *UsersService) UpdateProfile(userID uint, req *types.UpdateProfileReques
 		return nil, utils.ErrInternalServer
 	}
 
-	return &types.UserResponse{
-		ID:    user.ID,
-		Email: user.Email,
-		Name:  user.Name,
-	}, nil
+	if len(changed) > 0 {
+		s.audit(model.AuditProfileUpdated, user.ID, user.ID, map[string]interface{}{
+			"fields": changed,
+		})
+	}
+
+	response := ToUserResponse(user)
+	return &response, nil
+}
+
+// DeleteAccount soft-deletes the user and revokes all of their sessions
+func (s *UsersService) DeleteAccount(userID uint) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.DB.Delete(user).Error; err != nil {
+		return utils.ErrInternalServer
+	}
+
+	if err := revokeUserTokens(s.DB, s.Revocations, user.ID); err != nil {
+		return err
+	}
+
+	s.audit(model.AuditAccountDeleted, user.ID, user.ID, nil)
+	return nil
 }
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	webAuthnRegistration = "registration"
+	webAuthnLogin        = "login"
+)
+
+// webAuthnUser adapts a user and their credentials to webauthn.User
+type webAuthnUser struct {
+	user        *model.User
+	credentials []model.WebAuthnCredential
+}
+
+// WebAuthnID is the user handle. It is the user ID rather than the email, so
+// it does not reveal anything about the user.
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return webAuthnUserHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, transport := range strings.Split(c.Transports, ",") {
+			if transport != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+func (u *webAuthnUser) descriptors() []protocol.CredentialDescriptor {
+	credentials := u.WebAuthnCredentials()
+	descriptors := make([]protocol.CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		descriptors = append(descriptors, c.Descriptor())
+	}
+	return descriptors
+}
+
+func webAuthnUserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// BeginWebAuthnRegistration starts registering a new passkey for the user
+func (s *AuthService) BeginWebAuthnRegistration(userID uint) (*types.WebAuthnBeginResponse, error) {
+	user, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(user.descriptors()),
+		// Logins are discoverable only, a key that cannot store the credential
+		// could never be used to sign in
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	sessionID, err := s.saveWebAuthnSession(webAuthnRegistration, &userID, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebAuthnBeginResponse{SessionID: sessionID, Options: creation}, nil
+}
+
+// FinishWebAuthnRegistration verifies the attestation and stores the new credential
+func (s *AuthService) FinishWebAuthnRegistration(userID uint, req *types.WebAuthnRegisterFinishRequest) (*model.WebAuthnCredential, error) {
+	session, err := s.consumeWebAuthnSession(req.SessionID, webAuthnRegistration, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		return nil, utils.ErrWebAuthnFailed
+	}
+
+	credential, err := s.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, utils.ErrWebAuthnFailed
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	record := model.WebAuthnCredential{
+		UserID:          userID,
+		Name:            req.Name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	s.audit(model.AuditPasskeyRegistered, model.AuditSuccess, userID, types.ClientInfo{}, map[string]interface{}{
+		"credential_id": record.ID,
+		"name":          record.Name,
+	})
+	return &record, nil
+}
+
+// BeginWebAuthnLogin starts a passkey login. The challenge never lists the
+// credentials of a user, the authenticator picks a discoverable credential and
+// names the user itself, so the response is the same for every visitor.
+func (s *AuthService) BeginWebAuthnLogin() (*types.WebAuthnBeginResponse, error) {
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	sessionID, err := s.saveWebAuthnSession(webAuthnLogin, nil, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebAuthnBeginResponse{SessionID: sessionID, Options: assertion}, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion and logs the user in. A passkey
+// already combines possession and user verification, so no TOTP code is asked.
+func (s *AuthService) FinishWebAuthnLogin(req *types.WebAuthnLoginFinishRequest, client types.ClientInfo) (*types.AuthResponse, error) {
+	session, err := s.consumeWebAuthnSession(req.SessionID, webAuthnLogin, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		return nil, utils.ErrWebAuthnFailed
+	}
+
+	var user *webAuthnUser
+	var credential *webauthn.Credential
+	if session.UserID == nil {
+		credential, err = s.webAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			if len(userHandle) != 8 {
+				return nil, utils.ErrWebAuthnFailed
+			}
+			user, err = s.loadWebAuthnUser(uint(binary.BigEndian.Uint64(userHandle)))
+			return user, err
+		}, *session, parsed)
+	} else {
+		if len(session.UserID) != 8 {
+			return nil, utils.ErrInvalidWebAuthnSession
+		}
+		if user, err = s.loadWebAuthnUser(uint(binary.BigEndian.Uint64(session.UserID))); err != nil {
+			return nil, utils.ErrWebAuthnFailed
+		}
+		credential, err = s.webAuthn.ValidateLogin(user, *session, parsed)
+	}
+	if err != nil {
+		return nil, utils.ErrWebAuthnFailed
+	}
+
+	// A signature counter that did not increase means the private key was copied
+	if credential.Authenticator.CloneWarning {
+		log.Printf("WebAuthn credential of user %d may be cloned, login refused", user.user.ID)
+		s.audit(model.AuditLoginFailed, model.AuditFailure, user.user.ID, client, map[string]interface{}{
+			"method": "passkey",
+			"reason": "CLONED_CREDENTIAL",
+		})
+		return nil, utils.ErrWebAuthnFailed
+	}
+
+	if err := s.db.Model(&model.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ?", user.user.ID, credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		}).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	if err := checkLoginAllowed(user.user); err != nil {
+		s.audit(model.AuditLoginFailed, model.AuditFailure, user.user.ID, client, map[string]interface{}{
+			"method": "passkey",
+			"reason": auditReason(err),
+		})
+		return nil, err
+	}
+
+	// Synced passkeys are not bound to a device
+	authMethod := authMethodHardwareKey
+	if credential.Flags.BackupEligible {
+		authMethod = authMethodSoftwareKey
+	}
+
+	tokens, err := s.issueTokens(user.user, client, authMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(model.AuditLoginSucceeded, model.AuditSuccess, user.user.ID, client, map[string]interface{}{
+		"method":     "passkey",
+		"session_id": tokens.RefreshTokenMetadata.FamilyID,
+	})
+
+	return &types.AuthResponse{
+		User:  ToUserResponse(user.user),
+		Token: tokens,
+	}, nil
+}
+
+// ListWebAuthnCredentials returns the passkeys registered by the user
+func (s *AuthService) ListWebAuthnCredentials(userID uint) ([]model.WebAuthnCredential, error) {
+	credentials := []model.WebAuthnCredential{}
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&credentials).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+	return credentials, nil
+}
+
+// DeleteWebAuthnCredential removes one of the passkeys of the user
+func (s *AuthService) DeleteWebAuthnCredential(userID, credentialID uint) error {
+	result := s.db.Where("id = ? AND user_id = ?", credentialID, userID).Delete(&model.WebAuthnCredential{})
+	if result.Error != nil {
+		return utils.ErrInternalServer
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrCredentialNotFound
+	}
+
+	s.audit(model.AuditPasskeyDeleted, model.AuditSuccess, userID, types.ClientInfo{}, map[string]interface{}{
+		"credential_id": credentialID,
+	})
+	return nil
+}
+
+// loadWebAuthnUser loads a user together with their credentials. Deleted
+// accounts are included so checkLoginAllowed reports them.
+func (s *AuthService) loadWebAuthnUser(userID uint) (*webAuthnUser, error) {
+	var user model.User
+	if err := s.db.Unscoped().First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	var credentials []model.WebAuthnCredential
+	if err := s.db.Where("user_id = ?", userID).Find(&credentials).Error; err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return &webAuthnUser{user: &user, credentials: credentials}, nil
+}
+
+// saveWebAuthnSession stores the ceremony state and returns its ID
+func (s *AuthService) saveWebAuthnSession(ceremony string, userID *uint, session *webauthn.SessionData) (string, error) {
+	id, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	// Abandoned ceremonies are cleaned up along the way
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&model.WebAuthnSession{}).Error; err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	record := model.WebAuthnSession{
+		ID:        id,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Data:      data,
+		ExpiresAt: session.Expires,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return "", utils.ErrInternalServer
+	}
+
+	return id, nil
+}
+
+// consumeWebAuthnSession loads and deletes the state of a ceremony, so every
+// challenge can only be answered once
+func (s *AuthService) consumeWebAuthnSession(id, ceremony string, userID *uint) (*webauthn.SessionData, error) {
+	var record model.WebAuthnSession
+	if err := s.db.First(&record, "id = ? AND ceremony = ?", id, ceremony).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidWebAuthnSession
+		}
+		return nil, utils.ErrInternalServer
+	}
+
+	result := s.db.Where("id = ?", record.ID).Delete(&model.WebAuthnSession{})
+	if result.Error != nil {
+		return nil, utils.ErrInternalServer
+	}
+	if result.RowsAffected == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, utils.ErrInvalidWebAuthnSession
+	}
+
+	// Registration sessions belong to the user who started them
+	if userID != nil && (record.UserID == nil || *record.UserID != *userID) {
+		return nil, utils.ErrInvalidWebAuthnSession
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(record.Data, &session); err != nil {
+		return nil, utils.ErrInternalServer
+	}
+
+	return &session, nil
+}
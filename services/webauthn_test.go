@@ -0,0 +1,304 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"jwt-auth-app/config"
+	"jwt-auth-app/model"
+	"jwt-auth-app/types"
+	"jwt-auth-app/utils"
+)
+
+const (
+	testRPID   = "auth.example.com"
+	testOrigin = "https://auth.example.com"
+)
+
+// Flags of the authenticator data
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// softAuthenticator is an ECDSA P-256 authenticator holding a single
+// discoverable credential, answering the ceremonies like a browser would
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return clientData
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+// create answers navigator.credentials.create() with a "none" attestation
+func (a *softAuthenticator) create(options interface{}) json.RawMessage {
+	a.t.Helper()
+
+	creation, ok := options.(*protocol.CredentialCreation)
+	if !ok {
+		a.t.Fatalf("registration options are %T", options)
+	}
+	if creation.Response.AuthenticatorSelection.ResidentKey != protocol.ResidentKeyRequirementRequired {
+		a.t.Errorf("resident key requirement is %q", creation.Response.AuthenticatorSelection.ResidentKey)
+	}
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	authData := a.authenticatorData(flagUserPresent | flagUserVerified | flagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(a.clientData("webauthn.create", creation.Response.Challenge)),
+		"attestationObject": encode(attestationObject),
+	})
+}
+
+// get answers navigator.credentials.get(), counting the signature
+func (a *softAuthenticator) get(options interface{}) json.RawMessage {
+	a.t.Helper()
+
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		a.t.Fatalf("login options are %T", options)
+	}
+
+	a.signCount++
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge)
+	authData := a.authenticatorData(flagUserPresent | flagUserVerified)
+	clientDataHash := sha256.Sum256(clientData)
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, sha256Sum(append(authData, clientDataHash[:]...)))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]string) json.RawMessage {
+	credential, err := json.Marshal(map[string]interface{}{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return credential
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// newTestWebAuthnService returns an AuthService with a relying party for testOrigin
+func newTestWebAuthnService(t *testing.T) *AuthService {
+	t.Helper()
+
+	if err := utils.InitializeWebAuthn(&config.WebAuthnConfig{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{testOrigin},
+		Timeout:       time.Minute,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, _ := newTestAuthService(t)
+	svc.webAuthn = utils.GetWebAuthn()
+	return svc
+}
+
+func registerPasskey(t *testing.T, svc *AuthService, userID uint, authenticator *softAuthenticator) {
+	t.Helper()
+
+	begin, err := svc.BeginWebAuthnRegistration(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinishWebAuthnRegistration(userID, &types.WebAuthnRegisterFinishRequest{
+		SessionID:  begin.SessionID,
+		Name:       "Test key",
+		Credential: authenticator.create(begin.Options),
+	}); err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+}
+
+func loginWithPasskey(t *testing.T, svc *AuthService, authenticator *softAuthenticator) (*types.AuthResponse, error) {
+	t.Helper()
+
+	begin, err := svc.BeginWebAuthnLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc.FinishWebAuthnLogin(&types.WebAuthnLoginFinishRequest{
+		SessionID:  begin.SessionID,
+		Credential: authenticator.get(begin.Options),
+	}, types.ClientInfo{IPAddress: "192.0.2.1"})
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	svc := newTestWebAuthnService(t)
+	user := createTestUser(t, svc, "passkey@example.com")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, svc, user.ID, authenticator)
+
+	for i := 1; i <= 2; i++ {
+		response, err := loginWithPasskey(t, svc, authenticator)
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if response.User.ID != user.ID {
+			t.Errorf("login %d: logged in as user %d, want %d", i, response.User.ID, user.ID)
+		}
+		if err := validateAccessToken(t, svc, response.Token.AccessToken); err != nil {
+			t.Errorf("login %d: access token: %v", i, err)
+		}
+	}
+
+	var credential model.WebAuthnCredential
+	if err := svc.db.Where("user_id = ?", user.ID).First(&credential).Error; err != nil {
+		t.Fatal(err)
+	}
+	if credential.SignCount != authenticator.signCount {
+		t.Errorf("stored sign count = %d, want %d", credential.SignCount, authenticator.signCount)
+	}
+}
+
+func TestWebAuthnLoginDoesNotListCredentials(t *testing.T) {
+	svc := newTestWebAuthnService(t)
+	user := createTestUser(t, svc, "listed@example.com")
+	registerPasskey(t, svc, user.ID, newSoftAuthenticator(t))
+
+	begin, err := svc.BeginWebAuthnLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed := begin.Options.(*protocol.CredentialAssertion).Response.AllowedCredentials; len(allowed) != 0 {
+		t.Errorf("login options list %d credentials", len(allowed))
+	}
+}
+
+func TestWebAuthnLoginSessionIsSingleUse(t *testing.T) {
+	svc := newTestWebAuthnService(t)
+	user := createTestUser(t, svc, "replay@example.com")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, svc, user.ID, authenticator)
+
+	begin, err := svc.BeginWebAuthnLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &types.WebAuthnLoginFinishRequest{SessionID: begin.SessionID, Credential: authenticator.get(begin.Options)}
+	if _, err := svc.FinishWebAuthnLogin(req, types.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinishWebAuthnLogin(req, types.ClientInfo{}); !errors.Is(err, utils.ErrInvalidWebAuthnSession) {
+		t.Errorf("replayed assertion: got %v, want %v", err, utils.ErrInvalidWebAuthnSession)
+	}
+}
+
+func TestWebAuthnLoginRefusesClonedCredential(t *testing.T) {
+	svc := newTestWebAuthnService(t)
+	user := createTestUser(t, svc, "cloned@example.com")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, svc, user.ID, authenticator)
+
+	// The copy of the key starts from the same counter as the original
+	clone := *authenticator
+	if _, err := loginWithPasskey(t, svc, authenticator); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loginWithPasskey(t, svc, &clone); !errors.Is(err, utils.ErrWebAuthnFailed) {
+		t.Errorf("login with the clone: got %v, want %v", err, utils.ErrWebAuthnFailed)
+	}
+
+	var event model.AuditEvent
+	if err := svc.db.Where("user_id = ? AND type = ?", user.ID, model.AuditLoginFailed).Last(&event).Error; err != nil {
+		t.Fatalf("no failed login audited: %v", err)
+	}
+	if !strings.Contains(event.Details, "CLONED_CREDENTIAL") {
+		t.Errorf("failed login audited with %s", event.Details)
+	}
+}
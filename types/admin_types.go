@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// ListUsersQuery holds the filters of the admin user listing
+type ListUsersQuery struct {
+	Cursor         string     `form:"cursor"`
+	Limit          int        `form:"limit" binding:"omitempty,min=1,max=100"`
+	Search         string     `form:"q"`
+	Role           string     `form:"role" binding:"omitempty,oneof=user admin super_admin"`
+	IsActive       *bool      `form:"is_active"`
+	CreatedAfter   *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore  *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	IncludeDeleted bool       `form:"include_deleted"`
+}
+
+type UserListResponse struct {
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin super_admin"`
+}
+
+type ChangeStatusRequest struct {
+	IsActive *bool `json:"is_active" binding:"required"`
+}
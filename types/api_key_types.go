@@ -0,0 +1,35 @@
+package types
+
+import "time"
+
+// CreateAPIKeyRequest creates an API key limited to the given permissions of
+// the user. Without an expiration the key stays valid until it is deleted.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=255"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,max=100,dive,required,max=100"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// UpdateAPIKeyRequest renames an API key and replaces its scopes
+type UpdateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" binding:"required,min=1,max=100,dive,required,max=100"`
+}
+
+type APIKeyResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Prefix is the start of the key, to recognize it
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeySecretResponse returns a new API key. The key is only shown once,
+// when it is created.
+type APIKeySecretResponse struct {
+	APIKey APIKeyResponse `json:"api_key"`
+	Key    string         `json:"key"`
+}
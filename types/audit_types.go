@@ -0,0 +1,60 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEventFilter holds the filters shared by the audit log listing and export
+type AuditEventFilter struct {
+	// Type is a comma separated list of event types, a trailing * matches a prefix, e.g. auth.login.*
+	Type          string     `form:"type"`
+	Outcome       string     `form:"outcome" binding:"omitempty,oneof=success failure"`
+	ActorID       *uint      `form:"actor_id"`
+	UserID        *uint      `form:"user_id"`
+	IPAddress     string     `form:"ip_address"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// ListAuditEventsQuery pages through the audit log, newest first
+type ListAuditEventsQuery struct {
+	AuditEventFilter
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ExportAuditEventsQuery exports the audit log in order. AfterID resumes an
+// export after the last event already exported.
+type ExportAuditEventsQuery struct {
+	AuditEventFilter
+	AfterID uint64 `form:"after_id"`
+}
+
+type AuditEventResponse struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	Outcome   string          `json:"outcome"`
+	ActorID   *uint           `json:"actor_id,omitempty"`
+	UserID    *uint           `json:"user_id,omitempty"`
+	IPAddress string          `json:"ip_address,omitempty"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+type AuditEventListResponse struct {
+	Events     []AuditEventResponse `json:"events"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// AuditChainVerification is the result of checking the hash chain of the audit log
+type AuditChainVerification struct {
+	Valid  bool   `json:"valid"`
+	Events uint64 `json:"events"`
+	// BrokenAt is the id of the first event that does not match the chain
+	BrokenAt *uint64 `json:"broken_at,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
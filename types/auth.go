@@ -1,8 +1,10 @@
 package types
 
+import "encoding/json"
+
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Name     string `json:"name" binding:"required,min=2"`
 }
 
@@ -12,16 +14,98 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	User  UserResponse `json:"user"`
-	Token TokenPair    `json:"tokens"`
+	User UserResponse `json:"user"`
+	// Token is omitted when the user has to verify their email address before
+	// logging in, or when a second factor is required
+	Token *TokenPair `json:"tokens,omitempty"`
+	// MFAToken is the challenge to exchange at /auth/mfa/verify for the token pair
+	MFAToken string `json:"mfa_token,omitempty"`
 }
 
 // ErrorResponse Custom error responses
 type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// RetryAfter is the number of seconds to wait before trying again, if any
+	RetryAfter int64 `json:"retry_after,omitempty"`
+	// Details lists the reasons a field of the request was refused
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError explains why the value of a request field was refused
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type RefreshTokenInput struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code is either a TOTP code or a recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	// QRCode is a data URI of a PNG image encoding OTPAuthURI
+	QRCode string `json:"qr_code"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	// Code is either a TOTP code or a recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type WebAuthnBeginResponse struct {
+	SessionID string `json:"session_id"`
+	// Options are passed to navigator.credentials.create() or .get()
+	Options interface{} `json:"options"`
+}
+
+type WebAuthnRegisterFinishRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+	// Name helps the user to tell their passkeys apart
+	Name string `json:"name" binding:"max=255"`
+	// Credential is the PublicKeyCredential returned by the browser
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnLoginFinishRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
@@ -5,4 +5,18 @@ type AuthenticatedUser struct {
 	ID    uint   `json:"id"`
 	Email string `json:"email"`
 	Name  string `json:"name"`
+	Role  string `json:"role"`
+}
+
+// AuthenticatedServiceAccount represents the authenticated service account in the context
+type AuthenticatedServiceAccount struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// ClientInfo describes the client a request came from
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
 }
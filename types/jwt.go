@@ -7,22 +7,91 @@ type TokenType string
 const (
 	AccessToken  TokenType = "access"
 	RefreshToken TokenType = "refresh"
+	// EmailVerificationToken is sent by email to prove ownership of an address
+	EmailVerificationToken TokenType = "email_verification"
+	// MFAChallengeToken is returned by login when a second factor is required
+	MFAChallengeToken TokenType = "mfa_pending"
 )
 
 type CustomClaims struct {
 	jwt.RegisteredClaims
 	UserID    uint      `json:"user_id"`
 	TokenType TokenType `json:"token_type"`
+	FamilyID  string    `json:"fid,omitempty"`
+	// SessionID is set on access tokens, they stop working once their session is revoked
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// EmailVerified is only set on access tokens of users who did not verify
+	// their email address yet
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Email         string `json:"email,omitempty"`
+	// ServiceAccountID is set instead of UserID on the access tokens of service accounts
+	ServiceAccountID string `json:"service_account_id,omitempty"`
+	// ClientID is set on the access tokens of sessions started by an OAuth client
+	ClientID string `json:"client_id,omitempty"`
+	// Scope is the space separated list of what an access token may be used
+	// for, RFC 9068 section 2.2.3. It is set on every access token, even when
+	// empty, to tell its tokens from the ones issued before scopes existed.
+	Scope *string `json:"scope,omitempty"`
+}
+
+// TokenSubject describes who a token pair is issued to
+type TokenSubject struct {
+	UserID        uint
+	Role          string
+	FamilyID      string
+	EmailVerified bool
+	// ServiceAccountID identifies a service account instead of a user
+	ServiceAccountID string
+	// ClientID is the OAuth client the session was started by, Scopes are
+	// granted to the access token
+	ClientID string
+	Scopes   []string
 }
 
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	// RefreshTokenMetadata describes the issued refresh token so it can be persisted
+	RefreshTokenMetadata *TokenMetadata `json:"-"`
 }
 
 type TokenMetadata struct {
+	TokenID   string
 	UserID    uint
 	TokenType TokenType
-	IssuedAt  int64
-	ExpiresAt int64
+	FamilyID  string
+	SessionID string
+	Role      string
+	// EmailVerified is false for the restricted access tokens of users who did
+	// not verify their email address yet
+	EmailVerified bool
+	Email         string
+	IssuedAt      int64
+	ExpiresAt     int64
+	// ServiceAccountID is set on the access tokens of service accounts, which
+	// have no user
+	ServiceAccountID string
+	// APIKeyID is set when the request authenticated with an API key instead
+	// of an access token
+	APIKeyID string
+	// ClientID is set on the access tokens of OAuth clients
+	ClientID string
+	// Scopes lists the permissions and OpenID Connect scopes the access token
+	// or API key is limited to. It is nil for access tokens issued before
+	// scopes existed, which are not limited.
+	Scopes []string
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. The subject is
+// the user ID and the audience the client ID, the profile and email claims are
+// only set when the matching scope was granted.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string   `json:"nonce,omitempty"`
+	AuthTime      int64    `json:"auth_time"`
+	AMR           []string `json:"amr,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified *bool    `json:"email_verified,omitempty"`
 }
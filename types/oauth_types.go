@@ -0,0 +1,110 @@
+package types
+
+import "time"
+
+// OAuthAuthorizeRequest holds the parameters of an authorization request,
+// RFC 6749 section 4.1.1 with the PKCE parameters of RFC 7636 and the nonce
+// of OpenID Connect. They are checked by the service so errors can be sent
+// back to the client.
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// OAuthConsentRequest is the decision of the user on an authorization request
+type OAuthConsentRequest struct {
+	OAuthAuthorizeRequest
+	Approve *bool `json:"approve" binding:"required"`
+}
+
+// OAuthConsentResponse describes the client asking for authorization
+type OAuthConsentResponse struct {
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name"`
+	// Scope lists the requested scopes
+	Scope []string `json:"scope"`
+	// ConsentGiven tells that the user already approved the client for
+	// every requested scope before
+	ConsentGiven bool `json:"consent_given"`
+}
+
+// OAuthRedirectResponse is the URI of the client to send the user back to,
+// with the authorization code or the error in its query
+type OAuthRedirectResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// OAuthTokenRequest holds the form parameters of the token endpoint. The
+// client may authenticate with HTTP Basic instead of ClientID and ClientSecret.
+// Service accounts may authenticate with a client assertion, RFC 7523.
+type OAuthTokenRequest struct {
+	GrantType           string `form:"grant_type"`
+	Code                string `form:"code"`
+	RedirectURI         string `form:"redirect_uri"`
+	CodeVerifier        string `form:"code_verifier"`
+	RefreshToken        string `form:"refresh_token"`
+	ClientID            string `form:"client_id"`
+	ClientSecret        string `form:"client_secret"`
+	ClientAssertionType string `form:"client_assertion_type"`
+	ClientAssertion     string `form:"client_assertion"`
+}
+
+// OAuthTokenResponse is the successful response of RFC 6749 section 5.1. The
+// ID token is only issued when the openid scope was granted, the client
+// credentials grant issues no refresh token.
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// UserInfoResponse holds the claims of the OpenID Connect userinfo endpoint,
+// the profile and email claims are only set when their scope was granted
+type UserInfoResponse struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// OAuthErrorResponse is the error response of RFC 6749 section 5.2
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	Type         string   `json:"type" binding:"required,oneof=public confidential"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,max=20,dive,required,max=2000"`
+}
+
+type UpdateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,max=20,dive,required,max=2000"`
+}
+
+type OAuthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// OAuthClientSecretResponse returns the secret of a confidential client. It
+// is only shown once, when the client is created or its secret rotated.
+type OAuthClientSecretResponse struct {
+	Client       OAuthClientResponse `json:"client"`
+	ClientSecret string              `json:"client_secret,omitempty"`
+}
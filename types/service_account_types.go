@@ -0,0 +1,39 @@
+package types
+
+import "time"
+
+// CreateServiceAccountRequest registers a service account. Without a public
+// key it gets a secret, with one it authenticates with private_key_jwt.
+type CreateServiceAccountRequest struct {
+	Name      string `json:"name" binding:"required,max=255"`
+	Role      string `json:"role" binding:"required,max=100"`
+	PublicKey string `json:"public_key" binding:"max=10000"`
+}
+
+// UpdateServiceAccountRequest changes a service account. The public key can
+// only be replaced on accounts that authenticate with a key.
+type UpdateServiceAccountRequest struct {
+	Name      string `json:"name" binding:"required,max=255"`
+	Role      string `json:"role" binding:"required,max=100"`
+	IsActive  *bool  `json:"is_active" binding:"required"`
+	PublicKey string `json:"public_key" binding:"max=10000"`
+}
+
+type ServiceAccountResponse struct {
+	ClientID string `json:"client_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	// AuthMethod is client_secret or private_key_jwt
+	AuthMethod string     `json:"auth_method"`
+	IsActive   bool       `json:"is_active"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// ServiceAccountSecretResponse returns the secret of a service account. It is
+// only shown once, when the account is created or its secret rotated.
+type ServiceAccountSecretResponse struct {
+	ServiceAccount ServiceAccountResponse `json:"service_account"`
+	ClientSecret   string                 `json:"client_secret,omitempty"`
+}
@@ -1,12 +1,49 @@
 package types
 
+import "time"
+
 type UpdateProfileRequest struct {
 	Name string `json:"name" binding:"required"`
 	// Add more fields as needed
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	// Password re-authenticates the user
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
 type UserResponse struct {
-	ID    uint   `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID                    uint       `json:"id"`
+	Email                 string     `json:"email"`
+	Name                  string     `json:"name"`
+	Role                  string     `json:"role"`
+	IsActive              bool       `json:"is_active"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+}
+
+// SessionResponse describes a device the user is logged in on
+type SessionResponse struct {
+	ID         string `json:"id"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	// ClientID is the OAuth client the session was started by, if any
+	ClientID   string    `json:"client_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// Current is set on the session of the access token used for the request
+	Current bool `json:"current"`
 }
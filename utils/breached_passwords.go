@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswordCorpus looks passwords up in a local copy of the Have I Been
+// Pwned range files: one file per 5 character SHA-1 prefix, named ABCDE.txt
+// or ABCDE, listing the remaining 35 characters and the number of
+// occurrences as SUFFIX:COUNT lines. Only the prefix file is read, the same
+// k-anonymity lookup the online API offers.
+type BreachedPasswordCorpus struct {
+	dir string
+}
+
+func NewBreachedPasswordCorpus(dir string) (*BreachedPasswordCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached password corpus: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password corpus: %s is not a directory", dir)
+	}
+	return &BreachedPasswordCorpus{dir: dir}, nil
+}
+
+// Count returns how often the password appeared in breaches, 0 if it is not
+// in the corpus. Missing prefix files are treated as empty.
+func (c *BreachedPasswordCorpus) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(c.dir, prefix))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("invalid count in %s: %q", file.Name(), count)
+		}
+		return n, nil
+	}
+
+	return 0, scanner.Err()
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientAssertionType is the client_assertion_type of private_key_jwt, RFC 7523 section 2.2
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientAssertionAlgorithms lists the algorithms client assertions may be
+// signed with, depending on the key of the client
+var ClientAssertionAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// minClientRSAKeyBits is the smallest RSA key accepted to sign client assertions
+const minClientRSAKeyBits = 2048
+
+// ParseClientPublicKey parses the PEM encoded public key a client signs its
+// assertions with
+func ParseClientPublicKey(data string) (interface{}, error) {
+	publicKey, err := parsePublicKey([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minClientRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minClientRSAKeyBits)
+		}
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+
+	return publicKey, nil
+}
+
+// clientAssertionMethods lists the algorithms the key may sign assertions with
+func clientAssertionMethods(publicKey interface{}) []string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return []string{"ES256"}
+		case 384:
+			return []string{"ES384"}
+		case 521:
+			return []string{"ES512"}
+		}
+	case ed25519.PublicKey:
+		return []string{"EdDSA"}
+	}
+	return nil
+}
+
+// VerifyClientAssertion verifies the client assertion of private_key_jwt,
+// RFC 7523 section 3. It must be signed with the client's key, issued by and
+// about the client, meant for one of the audiences, carry a jti and expire
+// within maxLifetime.
+func VerifyClientAssertion(assertion, publicKeyPEM, clientID string, audiences []string, maxLifetime time.Duration) (*jwt.RegisteredClaims, error) {
+	publicKey, err := ParseClientPublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(assertion, claims, func(*jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	},
+		jwt.WithValidMethods(clientAssertionMethods(publicKey)),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid client assertion")
+	}
+
+	if claims.ID == "" {
+		return nil, errors.New("client assertion has no jti")
+	}
+	if claims.ExpiresAt.After(time.Now().Add(maxLifetime)) {
+		return nil, fmt.Errorf("client assertion must expire within %s", maxLifetime)
+	}
+
+	for _, audience := range claims.Audience {
+		for _, accepted := range audiences {
+			if audience == accepted {
+				return claims, nil
+			}
+		}
+	}
+	return nil, errors.New("client assertion is not meant for this server")
+}
@@ -3,20 +3,139 @@ package utils
 import (
 	"errors"
 	"jwt-auth-app/types"
+	"math"
+	"time"
 )
 
 var (
-	ErrUserExists         = errors.New("USER_EXISTS")
-	ErrUserNotFound       = errors.New("USER_NOT_FOUND")
-	ErrInvalidCredentials = errors.New("INVALID_CREDENTIALS")
-	ErrInternalServer     = errors.New("INTERNAL_SERVER_ERROR")
-	ErrUnauthorized       = errors.New("UNAUTHORIZED")
-	ErrMissingAuthHeader  = errors.New("MISSING_AUTH_HEADER")
-	ErrInvalidAuthHeader  = errors.New("INVALID_AUTH_HEADER")
-	ErrInvalidToken       = errors.New("INVALID_TOKEN")
+	ErrUserExists             = errors.New("USER_EXISTS")
+	ErrUserNotFound           = errors.New("USER_NOT_FOUND")
+	ErrInvalidCredentials     = errors.New("INVALID_CREDENTIALS")
+	ErrAccountDisabled        = errors.New("ACCOUNT_DISABLED")
+	ErrAccountDeleted         = errors.New("ACCOUNT_DELETED")
+	ErrAccountLocked          = errors.New("ACCOUNT_LOCKED")
+	ErrRateLimited            = errors.New("RATE_LIMITED")
+	ErrPasswordResetRequired  = errors.New("PASSWORD_RESET_REQUIRED")
+	ErrInvalidResetToken      = errors.New("INVALID_RESET_TOKEN")
+	ErrWeakPassword           = errors.New("WEAK_PASSWORD")
+	ErrEmailNotVerified       = errors.New("EMAIL_NOT_VERIFIED")
+	ErrInvalidVerification    = errors.New("INVALID_VERIFICATION_TOKEN")
+	ErrInvalidEmailChange     = errors.New("INVALID_EMAIL_CHANGE_TOKEN")
+	ErrMFAAlreadyEnabled      = errors.New("MFA_ALREADY_ENABLED")
+	ErrMFANotEnabled          = errors.New("MFA_NOT_ENABLED")
+	ErrMFAEnrollmentNotFound  = errors.New("MFA_ENROLLMENT_NOT_FOUND")
+	ErrInvalidMFACode         = errors.New("INVALID_MFA_CODE")
+	ErrInvalidMFAToken        = errors.New("INVALID_MFA_TOKEN")
+	ErrInvalidWebAuthnSession = errors.New("INVALID_WEBAUTHN_SESSION")
+	ErrWebAuthnFailed         = errors.New("WEBAUTHN_VERIFICATION_FAILED")
+	ErrCredentialNotFound     = errors.New("CREDENTIAL_NOT_FOUND")
+	ErrSessionNotFound        = errors.New("SESSION_NOT_FOUND")
+	ErrInvalidCursor          = errors.New("INVALID_CURSOR")
+	ErrInternalServer         = errors.New("INTERNAL_SERVER_ERROR")
+	ErrUnauthorized           = errors.New("UNAUTHORIZED")
+	ErrForbidden              = errors.New("FORBIDDEN")
+	ErrMissingAuthHeader      = errors.New("MISSING_AUTH_HEADER")
+	ErrInvalidAuthHeader      = errors.New("INVALID_AUTH_HEADER")
+	ErrInvalidToken           = errors.New("INVALID_TOKEN")
+	ErrInvalidRefreshToken    = errors.New("INVALID_REFRESH_TOKEN")
+	ErrTokenRevoked           = errors.New("TOKEN_REVOKED")
+	ErrRefreshTokenReused     = errors.New("REFRESH_TOKEN_REUSED")
+	ErrTokenGeneration        = errors.New("TOKEN_GENERATION_FAILED")
+	ErrRoleNotFound           = errors.New("ROLE_NOT_FOUND")
+	ErrRoleExists             = errors.New("ROLE_EXISTS")
+	ErrRoleProtected          = errors.New("ROLE_PROTECTED")
+	ErrPermissionNotFound     = errors.New("PERMISSION_NOT_FOUND")
+	ErrPermissionExists       = errors.New("PERMISSION_EXISTS")
+	ErrInvalidPermission      = errors.New("INVALID_PERMISSION_NAME")
+	ErrOAuthClientNotFound    = errors.New("OAUTH_CLIENT_NOT_FOUND")
+	ErrInvalidRedirectURI     = errors.New("INVALID_REDIRECT_URI")
+	ErrRedirectURIMismatch    = errors.New("REDIRECT_URI_MISMATCH")
+	ErrPublicOAuthClient      = errors.New("PUBLIC_OAUTH_CLIENT")
+	ErrServiceAccountNotFound = errors.New("SERVICE_ACCOUNT_NOT_FOUND")
+	ErrInvalidPublicKey       = errors.New("INVALID_PUBLIC_KEY")
+	ErrAuthMethodMismatch     = errors.New("AUTH_METHOD_MISMATCH")
+	ErrAPIKeyNotFound         = errors.New("API_KEY_NOT_FOUND")
+	ErrInvalidAPIKeyScope     = errors.New("INVALID_API_KEY_SCOPE")
+	ErrInvalidExpiration      = errors.New("INVALID_EXPIRATION")
+	ErrInsufficientScope      = errors.New("INSUFFICIENT_SCOPE")
 )
 
+// Error codes of the OAuth endpoints, RFC 6749 sections 4.1.2.1 and 5.2
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+	// OAuthInsufficientScope is returned by resource endpoints, RFC 6750 section 3.1
+	OAuthInsufficientScope = "insufficient_scope"
+)
+
+// OAuthError is an error reported to an OAuth client with the codes of RFC
+// 6749, in the query of its redirect URI or in the body of a token response
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func NewOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// LockedError is returned while too many failed logins lock an account or a
+// client IP. It matches ErrAccountLocked with errors.Is.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// RetryAfterSeconds rounds the remaining lockout up to whole seconds
+func (e *LockedError) RetryAfterSeconds() int64 {
+	return int64(math.Ceil(e.RetryAfter.Seconds()))
+}
+
 func GetErrorResponse(err error) (int, types.ErrorResponse) {
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		return 429, types.ErrorResponse{
+			Code:       "ACCOUNT_LOCKED",
+			Message:    "Too many failed login attempts, try again later",
+			RetryAfter: locked.RetryAfterSeconds(),
+		}
+	}
+
+	var weak *PasswordPolicyError
+	if errors.As(err, &weak) {
+		return 400, types.ErrorResponse{
+			Code:    "WEAK_PASSWORD",
+			Message: "The password does not meet the password policy",
+			Details: weak.Violations,
+		}
+	}
+
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_AUTHORIZATION_REQUEST",
+			Message: oauthErr.Description,
+		}
+	}
+
 	switch err {
 	case ErrUserExists:
 		return 409, types.ErrorResponse{
@@ -33,11 +152,106 @@ func GetErrorResponse(err error) (int, types.ErrorResponse) {
 			Code:    "INVALID_CREDENTIALS",
 			Message: "Invalid email or password",
 		}
+	case ErrAccountDisabled:
+		return 403, types.ErrorResponse{
+			Code:    "ACCOUNT_DISABLED",
+			Message: "This account has been deactivated",
+		}
+	case ErrAccountDeleted:
+		return 403, types.ErrorResponse{
+			Code:    "ACCOUNT_DELETED",
+			Message: "This account has been deleted",
+		}
+	case ErrRateLimited:
+		return 429, types.ErrorResponse{
+			Code:    "RATE_LIMITED",
+			Message: "Too many requests, try again later",
+		}
+	case ErrPasswordResetRequired:
+		return 403, types.ErrorResponse{
+			Code:    "PASSWORD_RESET_REQUIRED",
+			Message: "The password of this account must be reset before logging in",
+		}
+	case ErrInvalidResetToken:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_RESET_TOKEN",
+			Message: "The password reset token is invalid, expired or was already used",
+		}
+	case ErrEmailNotVerified:
+		return 403, types.ErrorResponse{
+			Code:    "EMAIL_NOT_VERIFIED",
+			Message: "The email address of this account has not been verified",
+		}
+	case ErrInvalidVerification:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_VERIFICATION_TOKEN",
+			Message: "The email verification token is invalid or expired",
+		}
+	case ErrInvalidEmailChange:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_EMAIL_CHANGE_TOKEN",
+			Message: "The email change token is invalid, expired or was already used",
+		}
+	case ErrMFAAlreadyEnabled:
+		return 409, types.ErrorResponse{
+			Code:    "MFA_ALREADY_ENABLED",
+			Message: "Two-factor authentication is already enabled",
+		}
+	case ErrMFANotEnabled:
+		return 409, types.ErrorResponse{
+			Code:    "MFA_NOT_ENABLED",
+			Message: "Two-factor authentication is not enabled",
+		}
+	case ErrMFAEnrollmentNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "MFA_ENROLLMENT_NOT_FOUND",
+			Message: "No pending two-factor enrollment, start a new one",
+		}
+	case ErrInvalidMFACode:
+		return 401, types.ErrorResponse{
+			Code:    "INVALID_MFA_CODE",
+			Message: "Invalid authentication or recovery code",
+		}
+	case ErrInvalidMFAToken:
+		return 401, types.ErrorResponse{
+			Code:    "INVALID_MFA_TOKEN",
+			Message: "The MFA challenge is invalid or expired, log in again",
+		}
+	case ErrInvalidWebAuthnSession:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_WEBAUTHN_SESSION",
+			Message: "The WebAuthn session is invalid or expired, start again",
+		}
+	case ErrWebAuthnFailed:
+		return 401, types.ErrorResponse{
+			Code:    "WEBAUTHN_VERIFICATION_FAILED",
+			Message: "The passkey could not be verified",
+		}
+	case ErrCredentialNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "CREDENTIAL_NOT_FOUND",
+			Message: "Credential not found",
+		}
+	case ErrSessionNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "SESSION_NOT_FOUND",
+			Message: "Session not found",
+		}
+	case ErrInvalidCursor:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_CURSOR",
+			Message: "Invalid pagination cursor",
+		}
 	case ErrUnauthorized:
 		return 401, types.ErrorResponse{
 			Code:    "UNAUTHORIZED",
 			Message: "Unauthorized",
 		}
+	case ErrForbidden:
+		return 403, types.ErrorResponse{
+			Code:    "FORBIDDEN",
+			Message: "You do not have permission to access this resource",
+		}
 	case ErrMissingAuthHeader:
 		return 401, types.ErrorResponse{
 			Code:    "MISSING_AUTH_HEADER",
@@ -53,6 +267,111 @@ func GetErrorResponse(err error) (int, types.ErrorResponse) {
 			Code:    "INVALID_TOKEN",
 			Message: "Invalid token",
 		}
+	case ErrInvalidRefreshToken:
+		return 401, types.ErrorResponse{
+			Code:    "INVALID_REFRESH_TOKEN",
+			Message: "Invalid refresh token",
+		}
+	case ErrTokenRevoked:
+		return 401, types.ErrorResponse{
+			Code:    "TOKEN_REVOKED",
+			Message: "Token has been revoked",
+		}
+	case ErrRefreshTokenReused:
+		return 401, types.ErrorResponse{
+			Code:    "REFRESH_TOKEN_REUSED",
+			Message: "Refresh token was already used, the session has been revoked",
+		}
+	case ErrTokenGeneration:
+		return 500, types.ErrorResponse{
+			Code:    "TOKEN_GENERATION_FAILED",
+			Message: "Failed to generate new tokens",
+		}
+	case ErrRoleNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "ROLE_NOT_FOUND",
+			Message: "Role not found",
+		}
+	case ErrRoleExists:
+		return 409, types.ErrorResponse{
+			Code:    "ROLE_EXISTS",
+			Message: "Role with this name already exists",
+		}
+	case ErrRoleProtected:
+		return 409, types.ErrorResponse{
+			Code:    "ROLE_PROTECTED",
+			Message: "Built-in roles cannot be deleted",
+		}
+	case ErrPermissionNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "PERMISSION_NOT_FOUND",
+			Message: "Permission not found",
+		}
+	case ErrPermissionExists:
+		return 409, types.ErrorResponse{
+			Code:    "PERMISSION_EXISTS",
+			Message: "Permission with this name already exists",
+		}
+	case ErrInvalidPermission:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_PERMISSION_NAME",
+			Message: "Permission names must have the form resource:action",
+		}
+	case ErrOAuthClientNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "OAUTH_CLIENT_NOT_FOUND",
+			Message: "OAuth client not found",
+		}
+	case ErrInvalidRedirectURI:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_REDIRECT_URI",
+			Message: "Redirect URIs must be absolute without a fragment, and use https, http on the local machine or the reverse domain name scheme of a native app",
+		}
+	case ErrRedirectURIMismatch:
+		return 400, types.ErrorResponse{
+			Code:    "REDIRECT_URI_MISMATCH",
+			Message: "The redirect URI is not registered for this client",
+		}
+	case ErrPublicOAuthClient:
+		return 409, types.ErrorResponse{
+			Code:    "PUBLIC_OAUTH_CLIENT",
+			Message: "Public clients have no secret",
+		}
+	case ErrServiceAccountNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "SERVICE_ACCOUNT_NOT_FOUND",
+			Message: "Service account not found",
+		}
+	case ErrInvalidPublicKey:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_PUBLIC_KEY",
+			Message: "The public key must be a PEM encoded RSA key of at least 2048 bits, an ECDSA P-256, P-384 or P-521 key, or an Ed25519 key",
+		}
+	case ErrAuthMethodMismatch:
+		return 409, types.ErrorResponse{
+			Code:    "AUTH_METHOD_MISMATCH",
+			Message: "The service account authenticates with another method",
+		}
+	case ErrAPIKeyNotFound:
+		return 404, types.ErrorResponse{
+			Code:    "API_KEY_NOT_FOUND",
+			Message: "API key not found",
+		}
+	case ErrInvalidAPIKeyScope:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_API_KEY_SCOPE",
+			Message: "The scopes of an API key must be permissions you hold",
+		}
+	case ErrInvalidExpiration:
+		return 400, types.ErrorResponse{
+			Code:    "INVALID_EXPIRATION",
+			Message: "The expiration must be in the future",
+		}
+	case ErrInsufficientScope:
+		return 403, types.ErrorResponse{
+			Code:    "INSUFFICIENT_SCOPE",
+			Message: "The access token was not granted the scope this resource requires",
+		}
 	case ErrInternalServer:
 		return 500, types.ErrorResponse{
 			Code:    "INTERNAL_SERVER_ERROR",
@@ -65,3 +384,29 @@ func GetErrorResponse(err error) (int, types.ErrorResponse) {
 		}
 	}
 }
+
+// GetOAuthErrorResponse converts an error of the token or userinfo endpoint
+// to the response of RFC 6749 section 5.2
+func GetOAuthErrorResponse(err error) (int, types.OAuthErrorResponse) {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return 500, types.OAuthErrorResponse{
+			Error:            OAuthServerError,
+			ErrorDescription: "An unexpected error occurred",
+		}
+	}
+
+	status := 400
+	switch oauthErr.Code {
+	case OAuthInvalidClient:
+		status = 401
+	case OAuthInsufficientScope:
+		status = 403
+	case OAuthServerError:
+		status = 500
+	}
+	return status, types.OAuthErrorResponse{
+		Error:            oauthErr.Code,
+		ErrorDescription: oauthErr.Description,
+	}
+}
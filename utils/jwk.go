@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jwkMembers returns the required JWK members of a public key as defined by
+// RFC 7517/7518/8037
+func jwkMembers(publicKey interface{}) (map[string]string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC",
+			"crv": key.Curve.Params().Name,
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// jwkThumbprint computes the RFC 7638 SHA-256 thumbprint of a public key
+func jwkThumbprint(publicKey interface{}) (string, error) {
+	members, err := jwkMembers(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	// encoding/json sorts map keys, which gives the lexicographic member order
+	// required by the thumbprint
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"fmt"
+	"jwt-auth-app/config"
+	"jwt-auth-app/types"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTKey is a single key identified by the kid header of the tokens it signs
+type JWTKey struct {
+	ID         string
+	method     jwt.SigningMethod
+	privateKey interface{} // nil for keys that are only used for verification
+	publicKey  interface{}
+	expiresAt  time.Time // zero while the key is configured
+}
+
+// KeyRing holds the key used to sign new tokens of one type together with
+// every key that is still accepted when verifying them
+type KeyRing struct {
+	signingKey *JWTKey
+	keys       map[string]*JWTKey
+}
+
+// newJWTKey identifies keys without an explicit kid by their thumbprint. A
+// thumbprint of a shared secret would let anyone check guesses of the secret
+// offline, so symmetric keys need an explicit kid.
+func newJWTKey(keyID string, method jwt.SigningMethod, privateKey, publicKey interface{}) (*JWTKey, error) {
+	if keyID == "" {
+		if _, symmetric := publicKey.([]byte); symmetric {
+			return nil, fmt.Errorf("%s keys need an explicit key ID", method.Alg())
+		}
+		thumbprint, err := jwkThumbprint(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		keyID = thumbprint
+	}
+
+	return &JWTKey{
+		ID:         keyID,
+		method:     method,
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}, nil
+}
+
+// symmetric reports whether the key is a shared secret
+func (k *JWTKey) symmetric() bool {
+	_, symmetric := k.publicKey.([]byte)
+	return symmetric
+}
+
+func newKeyRing(method jwt.SigningMethod, cfg config.TokenConfig) (*KeyRing, error) {
+	signingKey, err := loadKey(method, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &KeyRing{
+		signingKey: signingKey,
+		keys:       map[string]*JWTKey{signingKey.ID: signingKey},
+	}
+
+	for _, entry := range cfg.RetiredKeyPaths {
+		key, err := loadVerificationKey(method, entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load retired key %s: %w", entry, err)
+		}
+		if _, exists := ring.keys[key.ID]; !exists {
+			ring.keys[key.ID] = key
+		}
+	}
+
+	return ring, nil
+}
+
+// retain carries over keys from the previous ring that are no longer configured.
+// The old signing key stays valid for one token lifetime so that every token it
+// signed can still be verified until it expires.
+func (r *KeyRing) retain(previous *KeyRing, lifetime time.Duration, now time.Time) {
+	if previous == nil {
+		return
+	}
+
+	for id, key := range previous.keys {
+		if _, exists := r.keys[id]; exists {
+			continue
+		}
+
+		expiresAt := key.expiresAt
+		if expiresAt.IsZero() {
+			expiresAt = now.Add(lifetime)
+		}
+		if !now.Before(expiresAt) {
+			continue
+		}
+
+		r.keys[id] = &JWTKey{
+			ID:        key.ID,
+			method:    key.method,
+			publicKey: key.publicKey,
+			expiresAt: expiresAt,
+		}
+	}
+}
+
+// verificationKey looks up the key for a kid header, falling back to the
+// signing key for tokens that carry no kid
+func (r *KeyRing) verificationKey(keyID string, now time.Time) (*JWTKey, bool) {
+	if keyID == "" {
+		return r.signingKey, true
+	}
+
+	key, ok := r.keys[keyID]
+	if !ok || (!key.expiresAt.IsZero() && !now.Before(key.expiresAt)) {
+		return nil, false
+	}
+
+	return key, true
+}
+
+// algorithms returns the signing algorithms of every key in the ring
+func (r *KeyRing) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range r.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// jwks returns the public keys of the ring that are still accepted, with the
+// signing key first. Symmetric keys are never published.
+func (r *KeyRing) jwks(now time.Time) (types.JWKSet, error) {
+	set := types.JWKSet{Keys: []types.JWK{}}
+
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i] == r.signingKey.ID || ids[j] == r.signingKey.ID {
+			return ids[i] == r.signingKey.ID
+		}
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		key := r.keys[id]
+		if _, symmetric := key.publicKey.([]byte); symmetric {
+			continue
+		}
+		if !key.expiresAt.IsZero() && !now.Before(key.expiresAt) {
+			continue
+		}
+
+		members, err := jwkMembers(key.publicKey)
+		if err != nil {
+			return types.JWKSet{}, err
+		}
+
+		set.Keys = append(set.Keys, types.JWK{
+			Kty: members["kty"],
+			Kid: key.ID,
+			Alg: key.method.Alg(),
+			Use: "sig",
+			Crv: members["crv"],
+			N:   members["n"],
+			E:   members["e"],
+			X:   members["x"],
+			Y:   members["y"],
+		})
+	}
+
+	return set, nil
+}
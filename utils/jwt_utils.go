@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -9,149 +12,408 @@ import (
 	"jwt-auth-app/config"
 	"jwt-auth-app/types"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type JWTKeys struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
-}
-
 type TokenManager struct {
-	accessKeys  JWTKeys
-	refreshKeys JWTKeys
+	mu          sync.RWMutex
+	accessKeys  *KeyRing
+	refreshKeys *KeyRing
 	config      *config.JWTConfig
 }
 
 var tokenManager *TokenManager
 
 func InitializeJWTManager(cfg *config.JWTConfig) error {
-	manager := &TokenManager{config: cfg}
+	manager := &TokenManager{}
+	if err := manager.Reload(cfg); err != nil {
+		return err
+	}
+
+	tokenManager = manager
+	return nil
+}
+
+// Reload re-reads the key files described by cfg. When the signing key changes,
+// the previous one is kept for verification until the tokens it signed expire,
+// so a new key can be promoted without logging anyone out.
+func (tm *TokenManager) Reload(cfg *config.JWTConfig) error {
+	method, err := getSigningMethod(cfg.Algorithm)
+	if err != nil {
+		return err
+	}
 
 	// Initialize access token keys
-	accessKeys, err := loadKeys(cfg.AccessToken.PrivateKeyPath, cfg.AccessToken.PublicKeyPath)
+	accessKeys, err := newKeyRing(method, cfg.AccessToken)
 	if err != nil {
 		return fmt.Errorf("failed to load access token keys: %w", err)
 	}
-	manager.accessKeys = accessKeys
 
 	// Initialize refresh token keys
-	refreshKeys, err := loadKeys(cfg.RefreshToken.PrivateKeyPath, cfg.RefreshToken.PublicKeyPath)
+	refreshKeys, err := newKeyRing(method, cfg.RefreshToken)
 	if err != nil {
 		return fmt.Errorf("failed to load refresh token keys: %w", err)
 	}
-	manager.refreshKeys = refreshKeys
 
-	tokenManager = manager
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	now := time.Now()
+	if tm.config != nil {
+		accessKeys.retain(tm.accessKeys, tm.config.AccessToken.ExpirationTime, now)
+		refreshKeys.retain(tm.refreshKeys, tm.config.RefreshToken.ExpirationTime, now)
+	}
+
+	tm.accessKeys = accessKeys
+	tm.refreshKeys = refreshKeys
+	tm.config = cfg
 	return nil
 }
 
-func loadKeys(privateKeyPath, publicKeyPath string) (JWTKeys, error) {
+// getSigningMethod resolves the configured JWT_ALGORITHM to a supported signing method
+func getSigningMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case "HS256", "HS384", "HS512",
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA":
+		return jwt.GetSigningMethod(alg), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %q", alg)
+	}
+}
+
+// loadKey loads the key used to sign new tokens. Its kid defaults to the
+// RFC 7638 thumbprint of the key when no explicit key ID is configured.
+func loadKey(method jwt.SigningMethod, cfg config.TokenConfig) (*JWTKey, error) {
+	// HMAC uses a single shared secret for signing and verification
+	if hmacMethod, ok := method.(*jwt.SigningMethodHMAC); ok {
+		secret, err := loadSecret(cfg.SecretPath, hmacMethod)
+		if err != nil {
+			return nil, err
+		}
+		return newJWTKey(cfg.KeyID, method, secret, secret)
+	}
+
 	// Load private key
-	privateKeyBytes, err := os.ReadFile(privateKeyPath)
+	privateKeyBytes, err := os.ReadFile(cfg.PrivateKeyPath)
 	if err != nil {
-		return JWTKeys{}, fmt.Errorf("failed to read private key: %w", err)
+		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
 
-	privateKeyBlock, _ := pem.Decode(privateKeyBytes)
-	if privateKeyBlock == nil {
-		return JWTKeys{}, errors.New("failed to decode private key PEM block")
+	privateKey, err := parsePrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	var privateKey *rsa.PrivateKey
+	// Load public key
+	publicKeyBytes, err := os.ReadFile(cfg.PublicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
 
-	// Try PKCS8 first
-	privateKeyParsed, err := x509.ParsePKCS8PrivateKey(privateKeyBlock.Bytes)
-	if err == nil {
-		var ok bool
-		privateKey, ok = privateKeyParsed.(*rsa.PrivateKey)
-		if !ok {
-			return JWTKeys{}, errors.New("private key is not RSA key")
-		}
-	} else {
-		// Fallback to PKCS1
-		privateKey, err = x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
+	publicKey, err := parsePublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKeyType(method, privateKey, publicKey); err != nil {
+		return nil, err
+	}
+
+	return newJWTKey(cfg.KeyID, method, privateKey, publicKey)
+}
+
+// loadVerificationKey loads a retired key that is only used to verify tokens.
+// Entries are either a plain path or "kid=path" when the key was signing under
+// an explicit key ID.
+func loadVerificationKey(method jwt.SigningMethod, entry string) (*JWTKey, error) {
+	keyID, path := "", entry
+	if i := strings.Index(entry, "="); i >= 0 {
+		keyID, path = entry[:i], entry[i+1:]
+	}
+
+	if hmacMethod, ok := method.(*jwt.SigningMethodHMAC); ok {
+		secret, err := loadSecret(path, hmacMethod)
 		if err != nil {
-			return JWTKeys{}, fmt.Errorf("failed to parse private key: %w", err)
+			return nil, err
 		}
+		return newJWTKey(keyID, method, nil, secret)
 	}
 
-	// Load public key
-	publicKeyBytes, err := os.ReadFile(publicKeyPath)
+	publicKeyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	publicKey, err := parsePublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKeyType(method, nil, publicKey); err != nil {
+		return nil, err
+	}
+
+	return newJWTKey(keyID, method, nil, publicKey)
+}
+
+func loadSecret(path string, method *jwt.SigningMethodHMAC) ([]byte, error) {
+	secret, err := os.ReadFile(path)
 	if err != nil {
-		return JWTKeys{}, fmt.Errorf("failed to read public key: %w", err)
+		return nil, fmt.Errorf("failed to read secret key: %w", err)
+	}
+
+	secret = bytes.TrimSpace(secret)
+	if len(secret) < method.Hash.Size() {
+		return nil, fmt.Errorf("secret key for %s must be at least %d bytes", method.Alg(), method.Hash.Size())
 	}
 
-	publicKeyBlock, _ := pem.Decode(publicKeyBytes)
+	return secret, nil
+}
+
+func parsePrivateKey(data []byte) (interface{}, error) {
+	privateKeyBlock, _ := pem.Decode(data)
+	if privateKeyBlock == nil {
+		return nil, errors.New("failed to decode private key PEM block")
+	}
+
+	// Try PKCS8 first, it covers RSA, ECDSA and Ed25519 keys
+	if privateKey, err := x509.ParsePKCS8PrivateKey(privateKeyBlock.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	// Fallback to PKCS1 for RSA keys
+	if privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	// Fallback to SEC1 for EC keys
+	privateKey, err := x509.ParseECPrivateKey(privateKeyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return privateKey, nil
+}
+
+func parsePublicKey(data []byte) (interface{}, error) {
+	publicKeyBlock, _ := pem.Decode(data)
 	if publicKeyBlock == nil {
-		return JWTKeys{}, errors.New("failed to decode public key PEM block")
+		return nil, errors.New("failed to decode public key PEM block")
 	}
 
-	parsedPublicKey, err := x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
+	publicKey, err := x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
 	if err != nil {
-		return JWTKeys{}, fmt.Errorf("failed to parse public key: %w", err)
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
 	}
 
-	publicKey, ok := parsedPublicKey.(*rsa.PublicKey)
-	if !ok {
-		return JWTKeys{}, errors.New("public key is not RSA key")
+	return publicKey, nil
+}
+
+// checkKeyType makes sure the loaded key pair can be used with the signing method.
+// A nil private key is accepted for verification-only keys.
+func checkKeyType(method jwt.SigningMethod, privateKey, publicKey interface{}) error {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := privateKey.(*rsa.PrivateKey); privateKey != nil && !ok {
+			return errors.New("private key is not RSA key")
+		}
+		if _, ok := publicKey.(*rsa.PublicKey); !ok {
+			return errors.New("public key is not RSA key")
+		}
+	case *jwt.SigningMethodECDSA:
+		if ecPrivateKey, ok := privateKey.(*ecdsa.PrivateKey); privateKey != nil {
+			if !ok {
+				return errors.New("private key is not ECDSA key")
+			}
+			if ecPrivateKey.Curve.Params().BitSize != m.CurveBits {
+				return fmt.Errorf("ECDSA key curve does not match %s", m.Alg())
+			}
+		}
+		ecPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("public key is not ECDSA key")
+		}
+		if ecPublicKey.Curve.Params().BitSize != m.CurveBits {
+			return fmt.Errorf("ECDSA key curve does not match %s", m.Alg())
+		}
+	case *jwt.SigningMethodEd25519:
+		if _, ok := privateKey.(ed25519.PrivateKey); privateKey != nil && !ok {
+			return errors.New("private key is not Ed25519 key")
+		}
+		if _, ok := publicKey.(ed25519.PublicKey); !ok {
+			return errors.New("public key is not Ed25519 key")
+		}
+	default:
+		return fmt.Errorf("unsupported signing method: %s", method.Alg())
 	}
 
-	return JWTKeys{
-		privateKey: privateKey,
-		publicKey:  publicKey,
-	}, nil
+	return nil
 }
 
-func (tm *TokenManager) GenerateTokenPair(userID uint) (*types.TokenPair, error) {
+func (tm *TokenManager) GenerateTokenPair(subject types.TokenSubject) (*types.TokenPair, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
 	// Generate access token
-	accessToken, err := tm.generateToken(userID, types.AccessToken, tm.accessKeys, tm.config.AccessToken.ExpirationTime)
+	accessToken, _, err := tm.generateToken(subject, types.AccessToken, tm.accessKeys.signingKey, tm.config.AccessToken.ExpirationTime)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
 	// Generate refresh token
-	refreshToken, err := tm.generateToken(userID, types.RefreshToken, tm.refreshKeys, tm.config.RefreshToken.ExpirationTime)
+	refreshToken, refreshMetadata, err := tm.generateToken(subject, types.RefreshToken, tm.refreshKeys.signingKey, tm.config.RefreshToken.ExpirationTime)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
 	return &types.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:          accessToken,
+		RefreshToken:         refreshToken,
+		RefreshTokenMetadata: refreshMetadata,
 	}, nil
 }
 
-func (tm *TokenManager) generateToken(userID uint, tokenType types.TokenType, keys JWTKeys, expiration time.Duration) (string, error) {
+// GenerateAccessToken issues an access token without a refresh token, as the
+// client credentials grant of service accounts does
+func (tm *TokenManager) GenerateAccessToken(subject types.TokenSubject) (string, *types.TokenMetadata, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	return tm.generateToken(subject, types.AccessToken, tm.accessKeys.signingKey, tm.config.AccessToken.ExpirationTime)
+}
+
+func (tm *TokenManager) generateToken(subject types.TokenSubject, tokenType types.TokenType, key *JWTKey, expiration time.Duration) (string, *types.TokenMetadata, error) {
+	// A random jti lets individual tokens be revoked
+	tokenID, err := GenerateRandomID(16)
+	if err != nil {
+		return "", nil, err
+	}
+
 	now := time.Now()
 	claims := &types.CustomClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    tm.config.Issuer,
+		},
+		UserID:    subject.UserID,
+		TokenType: tokenType,
+	}
+
+	// Only refresh tokens are tracked per family, access tokens name the
+	// family as their session and grant a role and scopes. Users who did not
+	// verify their email address get a restricted access token without a role.
+	if tokenType == types.RefreshToken {
+		claims.FamilyID = subject.FamilyID
+	} else {
+		claims.SessionID = subject.FamilyID
+		claims.ServiceAccountID = subject.ServiceAccountID
+		claims.ClientID = subject.ClientID
+		scope := strings.Join(subject.Scopes, " ")
+		claims.Scope = &scope
+		if subject.EmailVerified {
+			claims.Role = subject.Role
+		} else {
+			claims.EmailVerified = new(bool)
+		}
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.privateKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, metadataFromClaims(claims), nil
+}
+
+// GenerateStandaloneToken signs a token that is not part of a token pair, such
+// as an email verification link or an MFA challenge. These are signed with the
+// refresh token keys, which are never published.
+func (tm *TokenManager) GenerateStandaloneToken(userID uint, email string, tokenType types.TokenType, expiration time.Duration) (string, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tokenID, err := GenerateRandomID(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &types.CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    tm.config.Issuer,
 		},
 		UserID:    userID,
 		TokenType: tokenType,
+		Email:     email,
+	}
+
+	key := tm.refreshKeys.signingKey
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.privateKey)
+}
+
+// GenerateIDToken signs an OpenID Connect ID token. It is signed with the
+// access token keys so clients can verify it with the published JWKS.
+func (tm *TokenManager) GenerateIDToken(claims *types.IDTokenClaims) (string, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tokenID, err := GenerateRandomID(16)
+	if err != nil {
+		return "", err
+	}
+
+	key := tm.accessKeys.signingKey
+	if key.symmetric() {
+		return "", errors.New("ID tokens cannot be signed with a shared secret")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(keys.privateKey)
+	now := time.Now()
+	claims.ID = tokenID
+	claims.Issuer = tm.config.Issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(tm.config.AccessToken.ExpirationTime))
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.privateKey)
 }
 
 func (tm *TokenManager) ValidateToken(tokenString string, tokenType types.TokenType) (*types.TokenMetadata, error) {
-	keys := tm.accessKeys
-	if tokenType == types.RefreshToken {
-		keys = tm.refreshKeys
+	tm.mu.RLock()
+	keys := tm.refreshKeys
+	if tokenType == types.AccessToken {
+		keys = tm.accessKeys
 	}
+	tm.mu.RUnlock()
 
 	token, err := jwt.ParseWithClaims(tokenString, &types.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		// Tokens issued before kid headers were introduced are verified with the signing key
+		keyID, _ := token.Header["kid"].(string)
+		key, ok := keys.verificationKey(keyID, time.Now())
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %v", token.Header["kid"])
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return keys.publicKey, nil
-	})
+		return key.publicKey, nil
+	}, jwt.WithValidMethods(keys.algorithms()))
 
 	if err != nil {
 		return nil, err
@@ -166,17 +428,59 @@ func (tm *TokenManager) ValidateToken(tokenString string, tokenType types.TokenT
 		return nil, errors.New("invalid token type")
 	}
 
+	return metadataFromClaims(claims), nil
+}
+
+func metadataFromClaims(claims *types.CustomClaims) *types.TokenMetadata {
+	// Scopes stays nil on tokens without the claim, an empty scope limits the
+	// token to nothing
+	var scopes []string
+	if claims.Scope != nil {
+		scopes = append([]string{}, strings.Fields(*claims.Scope)...)
+	}
+
 	return &types.TokenMetadata{
+		TokenID:   claims.ID,
 		UserID:    claims.UserID,
 		TokenType: claims.TokenType,
-		IssuedAt:  claims.IssuedAt.Unix(),
-		ExpiresAt: claims.ExpiresAt.Unix(),
-	}, nil
+		FamilyID:  claims.FamilyID,
+		SessionID: claims.SessionID,
+		Role:      claims.Role,
+		// Tokens without the claim were issued to verified users or before verification existed
+		EmailVerified:    claims.EmailVerified == nil || *claims.EmailVerified,
+		Email:            claims.Email,
+		IssuedAt:         claims.IssuedAt.Unix(),
+		ExpiresAt:        claims.ExpiresAt.Unix(),
+		ServiceAccountID: claims.ServiceAccountID,
+		ClientID:         claims.ClientID,
+		Scopes:           scopes,
+	}
+}
+
+// SignsIDTokens reports whether ID tokens can be issued. Relying parties verify
+// them with the JWKS, which never publishes shared secrets.
+func (tm *TokenManager) SignsIDTokens() bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	return !tm.accessKeys.signingKey.symmetric()
+}
+
+// AccessJWKS returns the public keys that verify access tokens
+func (tm *TokenManager) AccessJWKS() (types.JWKSet, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	return tm.accessKeys.jwks(time.Now())
 }
 
 // GenerateTokenPair Helper functions to expose the functionality
-func GenerateTokenPair(userID uint) (*types.TokenPair, error) {
-	return tokenManager.GenerateTokenPair(userID)
+func GenerateTokenPair(subject types.TokenSubject) (*types.TokenPair, error) {
+	return tokenManager.GenerateTokenPair(subject)
+}
+
+func GenerateAccessToken(subject types.TokenSubject) (string, *types.TokenMetadata, error) {
+	return tokenManager.GenerateAccessToken(subject)
 }
 
 func ValidateAccessToken(tokenString string) (*types.TokenMetadata, error) {
@@ -186,3 +490,36 @@ func ValidateAccessToken(tokenString string) (*types.TokenMetadata, error) {
 func ValidateRefreshToken(tokenString string) (*types.TokenMetadata, error) {
 	return tokenManager.ValidateToken(tokenString, types.RefreshToken)
 }
+
+func GenerateEmailVerificationToken(userID uint, email string, expiration time.Duration) (string, error) {
+	return tokenManager.GenerateStandaloneToken(userID, email, types.EmailVerificationToken, expiration)
+}
+
+func ValidateEmailVerificationToken(tokenString string) (*types.TokenMetadata, error) {
+	return tokenManager.ValidateToken(tokenString, types.EmailVerificationToken)
+}
+
+func GenerateMFAChallengeToken(userID uint, expiration time.Duration) (string, error) {
+	return tokenManager.GenerateStandaloneToken(userID, "", types.MFAChallengeToken, expiration)
+}
+
+func ValidateMFAChallengeToken(tokenString string) (*types.TokenMetadata, error) {
+	return tokenManager.ValidateToken(tokenString, types.MFAChallengeToken)
+}
+
+func GenerateIDToken(claims *types.IDTokenClaims) (string, error) {
+	return tokenManager.GenerateIDToken(claims)
+}
+
+func SignsIDTokens() bool {
+	return tokenManager.SignsIDTokens()
+}
+
+func GetAccessJWKS() (types.JWKSet, error) {
+	return tokenManager.AccessJWKS()
+}
+
+// ReloadJWTKeys reloads the token keys, e.g. after a new signing key was promoted
+func ReloadJWTKeys(cfg *config.JWTConfig) error {
+	return tokenManager.Reload(cfg)
+}
@@ -0,0 +1,17 @@
+package mailer
+
+import "log"
+
+// LogMailer writes emails to the application log instead of delivering them
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Email from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
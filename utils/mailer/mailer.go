@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"fmt"
+	"jwt-auth-app/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var defaultMailer Mailer
+
+// New creates the mailer selected by MAIL_DRIVER
+func New(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.DropDir)
+	case "log", "":
+		return NewLogMailer(cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %q", cfg.Driver)
+	}
+}
+
+// InitializeMailer creates the mailer used by the services
+func InitializeMailer(cfg *config.MailConfig) error {
+	m, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	defaultMailer = m
+	return nil
+}
+
+// GetMailer returns the mailer created by InitializeMailer
+func GetMailer() Mailer {
+	return defaultMailer
+}
@@ -0,0 +1,354 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"jwt-auth-app/config"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	// bcryptSHA256ID marks bcrypt hashes of the HMAC-SHA256 of the password,
+	// which avoids the 72 byte limit of bcrypt
+	bcryptSHA256ID = "bcrypt-sha256"
+)
+
+var errUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords with one algorithm into PHC strings
+// ($id$params$salt$hash)
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, a hash this hasher Identifies
+	Verify(password, encoded string) (bool, error)
+	// Identifies reports whether encoded was produced by the algorithm of this hasher
+	Identifies(encoded string) bool
+	// NeedsRehash reports whether encoded was produced with other parameters or another pepper
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordManager hashes new passwords with the configured algorithm and
+// verifies the hashes of every supported one
+type PasswordManager struct {
+	current PasswordHasher
+	hashers []PasswordHasher
+}
+
+var passwordManager *PasswordManager
+
+// NewPasswordManager creates the hashers described by the configuration
+func NewPasswordManager(cfg *config.PasswordConfig) (*PasswordManager, error) {
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if cfg.Argon2Memory == 0 || cfg.Argon2Time == 0 || cfg.Argon2Parallelism == 0 {
+		return nil, errors.New("the argon2 memory, time and parallelism must be positive")
+	}
+
+	pepper := newPasswordPepper(cfg.Pepper)
+	bcryptHasher := &BcryptHasher{Cost: cfg.BcryptCost, pepper: pepper}
+	argon2Hasher := &Argon2idHasher{
+		Memory:      cfg.Argon2Memory,
+		Time:        cfg.Argon2Time,
+		Parallelism: cfg.Argon2Parallelism,
+		pepper:      pepper,
+	}
+
+	m := &PasswordManager{hashers: []PasswordHasher{argon2Hasher, bcryptHasher}}
+	switch cfg.HashAlgorithm {
+	case config.PasswordHashArgon2id:
+		m.current = argon2Hasher
+	case config.PasswordHashBcrypt:
+		m.current = bcryptHasher
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm: %q", cfg.HashAlgorithm)
+	}
+
+	return m, nil
+}
+
+// InitializePasswordManager creates the password manager used by the services
+func InitializePasswordManager(cfg *config.PasswordConfig) error {
+	m, err := NewPasswordManager(cfg)
+	if err != nil {
+		return err
+	}
+
+	passwordManager = m
+	return nil
+}
+
+// GetPasswordManager returns the password manager created by InitializePasswordManager
+func GetPasswordManager() *PasswordManager {
+	return passwordManager
+}
+
+// Hash hashes a new password with the configured algorithm
+func (m *PasswordManager) Hash(password string) (string, error) {
+	return m.current.Hash(password)
+}
+
+// Verify reports whether password matches encoded and, if it does, whether
+// encoded should be replaced by a hash with the current algorithm and parameters
+func (m *PasswordManager) Verify(password, encoded string) (match bool, needsRehash bool, err error) {
+	for _, hasher := range m.hashers {
+		if !hasher.Identifies(encoded) {
+			continue
+		}
+
+		match, err := hasher.Verify(password, encoded)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, hasher != m.current || hasher.NeedsRehash(encoded), nil
+	}
+	return false, false, errUnknownPasswordHash
+}
+
+// passwordPepper is the server-side secret mixed into the hashes. Hashes carry
+// a keyid derived from it, so a changed pepper is detected.
+type passwordPepper struct {
+	key []byte
+	id  string
+}
+
+func newPasswordPepper(secret string) passwordPepper {
+	if secret == "" {
+		return passwordPepper{}
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return passwordPepper{key: []byte(secret), id: hex.EncodeToString(sum[:4])}
+}
+
+// apply returns the input of the hash function, the HMAC-SHA256 of the
+// password when a pepper is configured
+func (p passwordPepper) apply(password string) []byte {
+	if p.key == nil {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// phcHash is a decoded $id[$v=version][$params]$salt$hash string
+type phcHash struct {
+	id     string
+	params map[string]string
+	salt   string
+	hash   string
+}
+
+func parsePHC(encoded string) (*phcHash, bool) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 4 || fields[0] != "" {
+		return nil, false
+	}
+
+	parsed := &phcHash{id: fields[1], params: make(map[string]string)}
+	rest := fields[2:]
+	for len(rest) > 2 && strings.Contains(rest[0], "=") {
+		for _, param := range strings.Split(rest[0], ",") {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok {
+				return nil, false
+			}
+			parsed.params[name] = value
+		}
+		rest = rest[1:]
+	}
+	if len(rest) != 2 {
+		return nil, false
+	}
+
+	parsed.salt, parsed.hash = rest[0], rest[1]
+	return parsed, true
+}
+
+func (h *phcHash) uintParam(name string, bitSize int) (uint64, bool) {
+	value, err := strconv.ParseUint(h.params[name], 10, bitSize)
+	return value, err == nil
+}
+
+// Argon2idHasher hashes passwords with argon2id
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Time        uint32
+	Parallelism uint8
+	pepper      passwordPepper
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey(h.pepper.apply(password), salt, h.Time, h.Memory, h.Parallelism, argon2KeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.Memory, h.Time, h.Parallelism)
+	if h.pepper.id != "" {
+		params += ",keyid=" + h.pepper.id
+	}
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	parsed, ok := parsePHC(encoded)
+	if !ok || parsed.id != "argon2id" {
+		return false, errUnknownPasswordHash
+	}
+
+	version, ok := parsed.uintParam("v", 32)
+	if !ok || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %q", parsed.params["v"])
+	}
+	memory, okM := parsed.uintParam("m", 32)
+	iterations, okT := parsed.uintParam("t", 32)
+	parallelism, okP := parsed.uintParam("p", 8)
+	if !okM || !okT || !okP {
+		return false, errors.New("invalid argon2 parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parsed.salt)
+	if err != nil {
+		return false, err
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parsed.hash)
+	if err != nil {
+		return false, err
+	}
+
+	// A hash made with another pepper cannot match
+	if parsed.params["keyid"] != h.pepper.id {
+		return false, nil
+	}
+
+	key := argon2.IDKey(h.pepper.apply(password), salt, uint32(iterations), uint32(memory), uint8(parallelism), uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+func (h *Argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	parsed, ok := parsePHC(encoded)
+	if !ok {
+		return true
+	}
+
+	return parsed.params["m"] != strconv.FormatUint(uint64(h.Memory), 10) ||
+		parsed.params["t"] != strconv.FormatUint(uint64(h.Time), 10) ||
+		parsed.params["p"] != strconv.FormatUint(uint64(h.Parallelism), 10) ||
+		parsed.params["keyid"] != h.pepper.id ||
+		len(parsed.salt) != base64.RawStdEncoding.EncodedLen(argon2SaltLength) ||
+		len(parsed.hash) != base64.RawStdEncoding.EncodedLen(argon2KeyLength)
+}
+
+// BcryptHasher hashes the HMAC-SHA256 of passwords with bcrypt, encoded as
+// $bcrypt-sha256$t=2a,r=<cost>$<salt>$<hash>. Plain bcrypt hashes ($2a$...)
+// are still verified but always need a rehash.
+type BcryptHasher struct {
+	Cost   int
+	pepper passwordPepper
+}
+
+// bcryptSaltLength is the length of the encoded salt in a bcrypt hash
+const bcryptSaltLength = 22
+
+// prehash derives the bcrypt input, 44 bytes whatever the length of the password
+func (h *BcryptHasher) prehash(password string) []byte {
+	mac := hmac.New(sha256.New, h.pepper.key)
+	mac.Write([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword(h.prehash(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	// hashed is $<t>$<cost>$<salt><hash>
+	fields := strings.Split(string(hashed), "$")
+	if len(fields) != 4 || len(fields[3]) <= bcryptSaltLength {
+		return "", errors.New("unexpected bcrypt hash")
+	}
+
+	params := fmt.Sprintf("t=%s,r=%d", fields[1], h.Cost)
+	if h.pepper.id != "" {
+		params += ",keyid=" + h.pepper.id
+	}
+	return fmt.Sprintf("$%s$%s$%s$%s", bcryptSHA256ID, params, fields[3][:bcryptSaltLength], fields[3][bcryptSaltLength:]), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	if isPlainBcrypt(encoded) {
+		return compareBcrypt(encoded, []byte(password))
+	}
+
+	parsed, ok := parsePHC(encoded)
+	if !ok || parsed.id != bcryptSHA256ID {
+		return false, errUnknownPasswordHash
+	}
+
+	cost, ok := parsed.uintParam("r", 8)
+	if !ok || parsed.params["t"] == "" {
+		return false, errors.New("invalid bcrypt parameters")
+	}
+
+	// A hash made with another pepper cannot match
+	if parsed.params["keyid"] != h.pepper.id {
+		return false, nil
+	}
+
+	hashed := fmt.Sprintf("$%s$%02d$%s%s", parsed.params["t"], cost, parsed.salt, parsed.hash)
+	return compareBcrypt(hashed, h.prehash(password))
+}
+
+func (h *BcryptHasher) Identifies(encoded string) bool {
+	return isPlainBcrypt(encoded) || strings.HasPrefix(encoded, "$"+bcryptSHA256ID+"$")
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	if isPlainBcrypt(encoded) {
+		return true
+	}
+
+	parsed, ok := parsePHC(encoded)
+	if !ok {
+		return true
+	}
+	return parsed.params["r"] != strconv.Itoa(h.Cost) || parsed.params["keyid"] != h.pepper.id
+}
+
+// isPlainBcrypt reports whether encoded is a bcrypt hash of the raw password,
+// as stored before passwords were prehashed
+func isPlainBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func compareBcrypt(hashed string, password []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hashed), password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"jwt-auth-app/config"
+	"jwt-auth-app/types"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reasons a password is refused, reported as the code of the field error
+const (
+	PasswordTooShort          = "too_short"
+	PasswordTooLong           = "too_long"
+	PasswordCharacterClasses  = "missing_character_classes"
+	PasswordTooWeak           = "too_weak"
+	PasswordContainsPersonal  = "contains_personal_info"
+	PasswordBreached          = "breached"
+	passwordPersonalMinLength = 3
+)
+
+// PasswordPolicyError lists every rule a password breaks. It matches
+// ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	Violations []types.FieldError
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error()
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// PasswordPolicy decides which passwords users may choose
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and
+	// symbols a password must mix
+	MinCharacterClasses int
+	// MinStrength is the minimal score of EstimatePasswordStrength, from 0 to 4
+	MinStrength          int
+	DisallowPersonalInfo bool
+	// Breaches is the corpus of leaked passwords, nil skips the check
+	Breaches        *BreachedPasswordCorpus
+	BreachThreshold int
+}
+
+var passwordPolicy *PasswordPolicy
+
+// NewPasswordPolicy creates the policy described by the configuration
+func NewPasswordPolicy(cfg *config.PasswordConfig) (*PasswordPolicy, error) {
+	if cfg.MinLength < 1 || cfg.MaxLength < cfg.MinLength {
+		return nil, errors.New("PASSWORD_MAX_LENGTH must be at least PASSWORD_MIN_LENGTH, which must be positive")
+	}
+	if cfg.MinStrength < 0 || cfg.MinStrength > 4 {
+		return nil, errors.New("PASSWORD_MIN_STRENGTH must be between 0 and 4")
+	}
+
+	policy := &PasswordPolicy{
+		MinLength:            cfg.MinLength,
+		MaxLength:            cfg.MaxLength,
+		MinCharacterClasses:  cfg.MinCharacterClasses,
+		MinStrength:          cfg.MinStrength,
+		DisallowPersonalInfo: cfg.DisallowPersonalInfo,
+		BreachThreshold:      cfg.BreachThreshold,
+	}
+
+	if cfg.BreachCorpusDir != "" {
+		corpus, err := NewBreachedPasswordCorpus(cfg.BreachCorpusDir)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breaches = corpus
+	}
+
+	return policy, nil
+}
+
+// InitializePasswordPolicy creates the password policy used by the services
+func InitializePasswordPolicy(cfg *config.PasswordConfig) error {
+	policy, err := NewPasswordPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	passwordPolicy = policy
+	return nil
+}
+
+// GetPasswordPolicy returns the password policy created by InitializePasswordPolicy
+func GetPasswordPolicy() *PasswordPolicy {
+	return passwordPolicy
+}
+
+// Validate checks a new password of the user with the given email and name.
+// It returns a *PasswordPolicyError listing every broken rule, reported on
+// the request field holding the password.
+func (p *PasswordPolicy) Validate(field, password, email, name string) error {
+	var violations []types.FieldError
+	violate := func(code, message string) {
+		violations = append(violations, types.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violate(PasswordTooShort, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if length > p.MaxLength {
+		violate(PasswordTooLong, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	if countCharacterClasses(password) < p.MinCharacterClasses {
+		violate(PasswordCharacterClasses, fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses))
+	}
+
+	personal := personalInfoTokens(email, name)
+	if p.DisallowPersonalInfo && containsAny(strings.ToLower(password), personal) {
+		violate(PasswordContainsPersonal, "must not contain your name or email address")
+	}
+
+	if EstimatePasswordStrength(password, personal...) < p.MinStrength {
+		violate(PasswordTooWeak, "is too easy to guess, avoid common words, sequences and repetitions")
+	}
+
+	if p.Breaches != nil {
+		count, err := p.Breaches.Count(password)
+		if err != nil {
+			log.Println("Failed to check breached passwords:", err)
+		} else if count >= p.BreachThreshold {
+			violate(PasswordBreached, "appeared in a data breach, choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func countCharacterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// personalInfoTokens splits the email address and name into the lowercase
+// words a password must not contain
+func personalInfoTokens(email, name string) []string {
+	var tokens []string
+	for _, token := range strings.FieldsFunc(strings.ToLower(email+" "+name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if utf8.RuneCountInString(token) >= passwordPersonalMinLength {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are among the most used passwords and words in passwords,
+// most common first. A match costs as many guesses as its rank.
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "login", "abc123",
+	"iloveyou", "monkey", "dragon", "football", "baseball", "master", "sunshine", "princess",
+	"shadow", "superman", "batman", "trustno1", "passw0rd", "starwars", "whatever", "freedom",
+	"hello", "charlie", "michael", "jordan", "jennifer", "hunter", "ranger", "secret",
+	"summer", "winter", "spring", "autumn", "soccer", "hockey", "killer", "pepper",
+	"cookie", "cheese", "chocolate", "flower", "orange", "banana", "computer", "internet",
+	"access", "change", "changeme", "default", "guest", "root", "test", "user",
+	"love", "angel", "family", "friend", "lovely", "money", "pass", "qwertyuiop",
+	"asdfgh", "zxcvbn", "google", "apple", "samsung", "mustang", "harley", "ginger",
+	"tigger", "maggie", "buster", "daniel", "thomas", "robert", "jessica", "ashley",
+}
+
+// keyboardRows are the rows of a qwerty keyboard, runs along a row are easy to guess
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetSubstitutions undoes common character substitutions before dictionary lookups
+var leetSubstitutions = strings.NewReplacer("4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// minPatternLength is the shortest run treated as a pattern rather than random characters
+const minPatternLength = 3
+
+// EstimatePasswordStrength scores a password from 0 (trivial to guess) to 4
+// (very hard to guess) like zxcvbn does: it estimates the number of guesses
+// an attacker needs, counting dictionary words, userInputs, repetitions,
+// sequences, keyboard runs and years as single guessable patterns.
+func EstimatePasswordStrength(password string, userInputs ...string) int {
+	guesses := estimateGuessesLog10(password, userInputs)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// estimateGuessesLog10 scans the password from left to right, taking the
+// longest pattern at every position and treating everything else as brute force
+func estimateGuessesLog10(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	unleet := []rune(leetSubstitutions.Replace(strings.ToLower(password)))
+	// The replacements are all single runes, so positions still line up
+	if len(unleet) != len(lower) {
+		unleet = lower
+	}
+
+	var total float64
+	var bruteForce []rune
+	flush := func() {
+		if len(bruteForce) > 0 {
+			total += float64(len(bruteForce)) * math.Log10(float64(charsetSize(bruteForce)))
+			bruteForce = nil
+		}
+	}
+
+	for i := 0; i < len(runes); {
+		length, guesses := matchPattern(runes, lower, unleet, i, userInputs)
+		if length < minPatternLength {
+			bruteForce = append(bruteForce, runes[i])
+			i++
+			continue
+		}
+
+		flush()
+		total += math.Log10(guesses)
+		i += length
+	}
+	flush()
+
+	return total
+}
+
+// matchPattern returns the length and guesses of the longest pattern at position i
+func matchPattern(runes, lower, unleet []rune, i int, userInputs []string) (int, float64) {
+	bestLength, bestGuesses := 0, 0.0
+	consider := func(length int, guesses float64) {
+		if length > bestLength || (length == bestLength && guesses < bestGuesses) {
+			bestLength, bestGuesses = length, guesses
+		}
+	}
+
+	// Dictionary words, user inputs being the easiest guesses of all
+	for rank, word := range commonPasswords {
+		if length, guesses := matchWord(runes, lower, unleet, i, word); length > 0 {
+			consider(length, guesses*float64(rank+1))
+		}
+	}
+	for _, word := range userInputs {
+		if length, guesses := matchWord(runes, lower, unleet, i, word); length > 0 {
+			consider(length, guesses)
+		}
+	}
+
+	// Repetitions of a single character
+	j := i + 1
+	for j < len(lower) && lower[j] == lower[i] {
+		j++
+	}
+	consider(j-i, float64(charsetSize(runes[i:i+1])*(j-i)))
+
+	// Sequences like abc, 987 or 2468
+	if i+1 < len(lower) {
+		delta := lower[i+1] - lower[i]
+		if delta != 0 && delta >= -2 && delta <= 2 {
+			j = i + 1
+			for j < len(lower) && lower[j]-lower[j-1] == delta {
+				j++
+			}
+			consider(j-i, float64(charsetSize(runes[i:i+1])*(j-i)))
+		}
+	}
+
+	// Runs along a keyboard row, in either direction
+	for _, row := range keyboardRows {
+		for _, r := range []string{row, reverseString(row)} {
+			if length := commonPrefixLength(lower[i:], []rune(r)); length > 0 {
+				consider(length, float64(len(r)*length))
+			}
+		}
+	}
+
+	// Years from 1900 to 2099
+	if i+4 <= len(lower) {
+		year := string(lower[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+			consider(4, 200)
+		}
+	}
+
+	return bestLength, bestGuesses
+}
+
+// matchWord matches word at position i, with twice the guesses when the case
+// or leet substitutions differ from the plain word
+func matchWord(runes, lower, unleet []rune, i int, word string) (int, float64) {
+	w := []rune(word)
+	if i+len(w) > len(lower) {
+		return 0, 0
+	}
+
+	guesses := 1.0
+	switch {
+	case string(lower[i:i+len(w)]) == word:
+	case string(unleet[i:i+len(w)]) == word:
+		guesses *= 2
+	default:
+		return 0, 0
+	}
+	if string(runes[i:i+len(w)]) != string(lower[i:i+len(w)]) {
+		guesses *= 2
+	}
+	return len(w), guesses
+}
+
+// charsetSize is the size of the character classes used by runes
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range runes {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	return size
+}
+
+// commonPrefixLength returns the length of the longest run of s found in
+// sequence, starting anywhere in sequence
+func commonPrefixLength(s, sequence []rune) int {
+	if len(s) == 0 {
+		return 0
+	}
+	start := strings.IndexRune(string(sequence), s[0])
+	if start < 0 {
+		return 0
+	}
+
+	seq := []rune(string(sequence)[start:])
+	length := 0
+	for length < len(s) && length < len(seq) && s[length] == seq[length] {
+		length++
+	}
+	return length
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired counters are dropped
+const sweepInterval = time.Minute
+
+type windowCounter struct {
+	window    int64
+	current   int64
+	previous  int64
+	expiresAt time.Time
+}
+
+// MemoryStore keeps the counters in memory, so every instance limits on its own
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*windowCounter
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters:  make(map[string]*windowCounter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Increment(key string, window int64, ttl time.Duration) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, counter := range s.counters {
+			if counter.expiresAt.Before(now) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	counter, ok := s.counters[key]
+	if !ok {
+		counter = &windowCounter{window: window}
+		s.counters[key] = counter
+	}
+
+	if counter.window != window {
+		if counter.window == window-1 {
+			counter.previous = counter.current
+		} else {
+			counter.previous = 0
+		}
+		counter.current = 0
+		counter.window = window
+	}
+
+	counter.current++
+	counter.expiresAt = now.Add(ttl)
+	return counter.current, counter.previous, nil
+}
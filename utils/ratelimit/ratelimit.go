@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"fmt"
+	"jwt-auth-app/config"
+	"math"
+	"time"
+)
+
+// Store keeps the request counters of fixed windows
+type Store interface {
+	// Increment counts a request for key in the window with the given index and
+	// returns the counters of that window and of the previous one. Counters
+	// must be kept for at least ttl.
+	Increment(key string, window int64, ttl time.Duration) (current int64, previous int64, err error)
+}
+
+// New creates the store selected by RATE_LIMIT_STORE
+func New(cfg *config.RateLimitConfig) (Store, error) {
+	switch cfg.Store {
+	case config.RateLimitStoreRedis:
+		return NewRedisStore(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+	case config.RateLimitStoreMemory, "":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store: %q", cfg.Store)
+	}
+}
+
+// Result describes the state of a limit after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the current window ends
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed, zero
+	// while requests are allowed
+	RetryAfter time.Duration
+}
+
+// Limiter applies a rate with a sliding window: the count of the previous
+// window is weighted by how much of it still overlaps the sliding window
+type Limiter struct {
+	store Store
+	name  string
+	rate  config.Rate
+}
+
+// NewLimiter creates a limiter, name separates its counters from the ones of
+// other limiters using the same store
+func NewLimiter(store Store, name string, rate config.Rate) *Limiter {
+	return &Limiter{store: store, name: name, rate: rate}
+}
+
+// Rate returns the rate enforced by the limiter
+func (l *Limiter) Rate() config.Rate {
+	return l.rate
+}
+
+// Allow counts a request for key and reports whether it stays within the rate.
+// Refused requests are counted as well, so clients that keep retrying stay limited.
+func (l *Limiter) Allow(key string, now time.Time) (Result, error) {
+	window := l.rate.Window
+	index := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() - index*int64(window))
+
+	current, previous, err := l.store.Increment(l.name+":"+key, index, 2*window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	limit := float64(l.rate.Requests)
+	estimate := float64(previous)*(1-float64(elapsed)/float64(window)) + float64(current)
+
+	result := Result{
+		Allowed:   estimate <= limit,
+		Limit:     l.rate.Requests,
+		Remaining: int(math.Max(0, math.Floor(limit-estimate))),
+		Reset:     window - elapsed,
+	}
+	if !result.Allowed {
+		result.RetryAfter = l.waitTime(current, previous, elapsed)
+	}
+	return result, nil
+}
+
+// waitTime returns how long it takes until the estimate leaves room for one more request
+func (l *Limiter) waitTime(current, previous int64, elapsed time.Duration) time.Duration {
+	window := float64(l.rate.Window)
+	room := float64(l.rate.Requests) - 1
+
+	// The previous window has to fade out enough within the current one
+	if float64(current) <= room {
+		if previous == 0 {
+			return 0
+		}
+		wait := window*(1-(room-float64(current))/float64(previous)) - float64(elapsed)
+		return time.Duration(math.Max(0, wait))
+	}
+
+	// Otherwise the current window becomes the previous one and has to fade out
+	return l.rate.Window - elapsed + time.Duration(window*(1-room/float64(current)))
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"jwt-auth-app/config"
+)
+
+// windowStart is the first instant of a one minute window
+var windowStart = time.Unix(1_700_000_040, 0)
+
+// testStores returns every backend, Redis talking to an in-process server
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	redisStore, err := NewRedisStore(server.Addr(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  redisStore,
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			limiter := NewLimiter(store, "login", config.Rate{Requests: 3, Window: time.Minute})
+
+			for i, wantRemaining := range []int{2, 1, 0} {
+				result, err := limiter.Allow("ip:192.0.2.1", windowStart.Add(time.Duration(i)*time.Second))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed {
+					t.Fatalf("request %d refused", i+1)
+				}
+				if result.Limit != 3 || result.Remaining != wantRemaining || result.RetryAfter != 0 {
+					t.Errorf("request %d: limit %d, remaining %d, retry after %v", i+1, result.Limit, result.Remaining, result.RetryAfter)
+				}
+				if want := time.Minute - time.Duration(i)*time.Second; result.Reset != want {
+					t.Errorf("request %d: reset %v, want %v", i+1, result.Reset, want)
+				}
+			}
+
+			refused, err := limiter.Allow("ip:192.0.2.1", windowStart.Add(3*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refused.Allowed || refused.Remaining != 0 || refused.RetryAfter <= 0 {
+				t.Fatalf("fourth request: %+v", refused)
+			}
+
+			// Other keys and other limiters have their own counters
+			if result, _ := limiter.Allow("ip:192.0.2.2", windowStart.Add(3*time.Second)); !result.Allowed {
+				t.Error("request of another IP refused")
+			}
+			other := NewLimiter(store, "register", config.Rate{Requests: 3, Window: time.Minute})
+			if result, _ := other.Allow("ip:192.0.2.1", windowStart.Add(3*time.Second)); !result.Allowed {
+				t.Error("request to another limiter refused")
+			}
+
+			// Retry-After is accurate: once it passed the next request is allowed
+			// while the previous window still weighs on the estimate
+			retry := windowStart.Add(3*time.Second + refused.RetryAfter)
+			if result, _ := limiter.Allow("ip:192.0.2.1", retry); !result.Allowed {
+				t.Errorf("request after Retry-After (%v) refused: %+v", refused.RetryAfter, result)
+			}
+		})
+	}
+}
+
+func TestLimiterSlidingWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		allowed bool
+	}{
+		// The four requests of the previous window still count fully
+		{"start of the next window", time.Minute, false},
+		// and a quarter of them counts three quarters into it
+		{"three quarters into the next window", time.Minute + 45*time.Second, true},
+	}
+
+	for name, store := range testStores(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				limiter := NewLimiter(store, tt.name, config.Rate{Requests: 3, Window: time.Minute})
+				for i := 0; i < 4; i++ {
+					if _, err := limiter.Allow("user:1", windowStart); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				result, err := limiter.Allow("user:1", windowStart.Add(tt.offset))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Allowed != tt.allowed {
+					t.Errorf("allowed = %v, want %v", result.Allowed, tt.allowed)
+				}
+			})
+		}
+	}
+}
+
+func TestRedisStoreExpiresCounters(t *testing.T) {
+	server := miniredis.RunT(t)
+	store, err := NewRedisStore(server.Addr(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Increment("key", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL(redisKeyPrefix + "key:1"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want %v", ttl, time.Minute)
+	}
+
+	server.FastForward(time.Minute)
+	current, previous, err := store.Increment("key", 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 1 || previous != 0 {
+		t.Errorf("after expiry: current %d, previous %d", current, previous)
+	}
+}
+
+func TestNewRedisStoreAuthenticates(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+
+	if _, err := NewRedisStore(server.Addr(), "wrong", 0); err == nil {
+		t.Error("wrong password accepted")
+	}
+	store, err := NewRedisStore(server.Addr(), "secret", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Increment("key", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	server.Select(2)
+	if !server.Exists(redisKeyPrefix + "key:1") {
+		t.Error("counter not stored in the selected database")
+	}
+}
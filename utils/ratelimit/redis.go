@@ -0,0 +1,248 @@
+package ratelimit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisKeyPrefix   = "ratelimit:"
+	redisDialTimeout = 5 * time.Second
+	redisIOTimeout   = 2 * time.Second
+	redisMaxIdle     = 8
+)
+
+// errRedisNil is the reply to a GET of a missing key
+var errRedisNil = errors.New("redis: nil")
+
+// RedisStore keeps the counters in Redis, or any server speaking its protocol,
+// so every instance shares the same limits. It only needs INCR, PEXPIRE and GET.
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// NewRedisStore connects to the server once to fail early on a wrong address or password
+func NewRedisStore(addr, password string, db int) (*RedisStore, error) {
+	s := &RedisStore{addr: addr, password: password, db: db}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.release(conn)
+
+	return s, nil
+}
+
+func (s *RedisStore) Increment(key string, window int64, ttl time.Duration) (int64, int64, error) {
+	currentKey := redisKeyPrefix + key + ":" + strconv.FormatInt(window, 10)
+	previousKey := redisKeyPrefix + key + ":" + strconv.FormatInt(window-1, 10)
+
+	conn, err := s.acquire()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	replies, err := conn.pipeline(
+		[]string{"INCR", currentKey},
+		[]string{"PEXPIRE", currentKey, strconv.FormatInt(ttl.Milliseconds(), 10)},
+		[]string{"GET", previousKey},
+	)
+	if err != nil {
+		conn.Close()
+		return 0, 0, err
+	}
+	s.release(conn)
+
+	current, ok := replies[0].(int64)
+	if !ok {
+		return 0, 0, fmt.Errorf("redis: unexpected INCR reply %v", replies[0])
+	}
+
+	var previous int64
+	switch reply := replies[2].(type) {
+	case string:
+		if previous, err = strconv.ParseInt(reply, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("redis: unexpected GET reply %q", reply)
+		}
+	case error:
+		if !errors.Is(reply, errRedisNil) {
+			return 0, 0, reply
+		}
+	}
+
+	return current, previous, nil
+}
+
+func (s *RedisStore) acquire() (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		conn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	return s.dial()
+}
+
+func (s *RedisStore) release(conn *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.idle) >= redisMaxIdle {
+		conn.Close()
+		return
+	}
+	s.idle = append(s.idle, conn)
+}
+
+func (s *RedisStore) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", s.addr, redisDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	var setup [][]string
+	if s.password != "" {
+		setup = append(setup, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	setup = append(setup, []string{"PING"})
+
+	replies, err := conn.pipeline(setup...)
+	if err == nil {
+		for _, reply := range replies {
+			if replyErr, ok := reply.(error); ok {
+				err = replyErr
+				break
+			}
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// redisConn speaks RESP2. Replies are decoded to string, int64, []interface{},
+// or an error for error replies and nil bulk strings.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// pipeline sends all commands at once and reads one reply per command
+func (c *redisConn) pipeline(commands ...[]string) ([]interface{}, error) {
+	if err := c.SetDeadline(time.Now().Add(redisIOTimeout)); err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	for _, args := range commands {
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(args)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, arg := range args {
+			buf = append(buf, '$')
+			buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+			buf = append(buf, '\r', '\n')
+			buf = append(buf, arg...)
+			buf = append(buf, '\r', '\n')
+		}
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	replies := make([]interface{}, len(commands))
+	for i := range commands {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New("redis: " + line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk reply %q", line)
+		}
+		if size < 0 {
+			return errRedisNil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array reply %q", line)
+		}
+		if size < 0 {
+			return errRedisNil, nil
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,73 @@
+package utils
+
+import "strings"
+
+// userAgentPattern maps a marker found in a User-Agent header to a readable name
+type userAgentPattern struct {
+	marker string
+	name   string
+}
+
+// Browsers are matched in order, most of them also claim to be Safari or Chrome
+var browserPatterns = []userAgentPattern{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// Mobile systems come first, their User-Agents also mention Linux or Mac OS X
+var osPatterns = []userAgentPattern{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName approximates a readable name such as "Firefox on Windows" from a
+// User-Agent header. Clients that are not browsers are named after their
+// first product token, such as "curl".
+func DeviceName(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := matchUserAgent(userAgent, browserPatterns)
+	os := matchUserAgent(userAgent, osPatterns)
+
+	if browser == "" && !strings.HasPrefix(userAgent, "Mozilla/") {
+		product, _, _ := strings.Cut(userAgent, " ")
+		browser, _, _ = strings.Cut(product, "/")
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
+
+func matchUserAgent(userAgent string, patterns []userAgentPattern) string {
+	for _, pattern := range patterns {
+		if strings.Contains(userAgent, pattern.marker) {
+			return pattern.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"jwt-auth-app/config"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// InitializeWebAuthn configures the relying party used for passkeys
+func InitializeWebAuthn(cfg *config.WebAuthnConfig) error {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    cfg.Timeout,
+		TimeoutUVD: cfg.Timeout,
+	}
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid WebAuthn configuration: %w", err)
+	}
+
+	webAuthn = wa
+	return nil
+}
+
+// GetWebAuthn returns the relying party created by InitializeWebAuthn
+func GetWebAuthn() *webauthn.WebAuthn {
+	return webAuthn
+}